@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/MagnunAVF/url-shortener/internal"
+)
+
+// aggregator does the analytics worker's job in process: it classifies
+// click events, records unique visitors in the memory cache and adds click
+// counts to storage, one batch at a time. There is no broker to redeliver
+// from, so a batch that fails to persist is dropped.
+type aggregator struct {
+	links     internal.LinkStore
+	cache     *internal.MemoryCache
+	bots      *internal.BotDetector
+	retention time.Duration
+	batchSize int
+	interval  time.Duration
+}
+
+// run processes events until the channel is closed, flushing whenever a
+// batch fills up or interval elapses.
+func (a *aggregator) run(events <-chan internal.ClickEvent) {
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	batch := make([]internal.ClickEvent, 0, a.batchSize)
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				a.process(batch)
+				return
+			}
+			batch = append(batch, event)
+			if len(batch) >= a.batchSize {
+				a.process(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			a.process(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+func (a *aggregator) process(events []internal.ClickEvent) {
+	if len(events) == 0 {
+		return
+	}
+
+	counts := make(map[string]*internal.URLAnalytics)
+	for _, event := range events {
+		class := a.bots.Classify(internal.ClickSignals{
+			Method:    event.Method,
+			UserAgent: event.UserAgent,
+			Accept:    event.Accept,
+			Purpose:   event.Purpose,
+		})
+		if event.VisitorID != "" {
+			key := internal.UniqueVisitorsKey(event.ShortCode, class, internal.VisitorDay(event.Timestamp))
+			a.cache.AddUniqueVisitor(key, event.VisitorID, a.retention)
+		}
+
+		rec, ok := counts[event.ShortCode]
+		if !ok {
+			rec = &internal.URLAnalytics{ShortCode: event.ShortCode}
+			counts[event.ShortCode] = rec
+		}
+		rec.ClickCount++
+		if class == internal.TrafficBot {
+			rec.BotClickCount++
+		} else {
+			rec.HumanClickCount++
+		}
+	}
+
+	recs := make([]internal.URLAnalytics, 0, len(counts))
+	for _, rec := range counts {
+		recs = append(recs, *rec)
+	}
+	sort.Slice(recs, func(i, j int) bool { return recs[i].ShortCode < recs[j].ShortCode })
+
+	if err := a.links.AddClicks(context.Background(), recs); err != nil {
+		slog.Error("Failed to record click counts, dropping batch", "err", err, "count", len(events))
+		return
+	}
+	slog.Info("Recorded click counts", "count", len(events))
+}
@@ -0,0 +1,123 @@
+package main
+
+// all-in-one runs the API, the ID generator and click aggregation in a single
+// process, with SQLite for storage and in-memory cache and event delivery.
+// Meant for developer laptops and small deployments: nothing is shared
+// between processes, so run a single replica.
+
+import (
+	"context"
+	"log/slog"
+	"os"
+
+	"github.com/glebarez/sqlite"
+	"github.com/joho/godotenv"
+	"gorm.io/gorm"
+
+	"github.com/MagnunAVF/url-shortener/internal"
+	"github.com/MagnunAVF/url-shortener/internal/api"
+	"github.com/MagnunAVF/url-shortener/internal/config"
+	"github.com/MagnunAVF/url-shortener/internal/idgen"
+	applog "github.com/MagnunAVF/url-shortener/internal/logger"
+	"github.com/MagnunAVF/url-shortener/internal/tracing"
+)
+
+// Click events waiting for the aggregator; beyond that they are dropped
+// rather than slowing redirects down.
+const clickBufferSize = 10000
+
+func main() {
+	if err := godotenv.Load(".env"); err != nil {
+		slog.Warn(".env file not found, relying on env vars", "err", err)
+	}
+
+	applog.InitFromEnv()
+
+	ctx := context.Background()
+	shutdownTracing, err := tracing.Init(ctx, "all-in-one")
+	if err != nil {
+		slog.Error("Failed to initialize tracing", "err", err)
+		os.Exit(1)
+	}
+	defer shutdownTracing(ctx)
+
+	conf, err := config.Load()
+	if err != nil {
+		slog.Error("Invalid configuration", "err", err)
+		os.Exit(1)
+	}
+
+	// WAL lets redirects read while clicks are written; the busy timeout
+	// covers the remaining writer contention.
+	dsn := conf.SQLite.Path + "?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)"
+	DB, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: applog.NewGormLogger(conf.Postgres.LogLevel)})
+	if err != nil {
+		slog.Error("Unable to open database", "err", err)
+		os.Exit(1)
+	}
+	if err := DB.Use(tracing.GormPlugin{}); err != nil {
+		slog.Error("Unable to instrument database", "err", err)
+		os.Exit(1)
+	}
+	// The SQL migrations target Postgres. A single process owns the SQLite
+	// file, so creating the schema from the models at startup is safe.
+	if err := DB.AutoMigrate(&internal.URL{}, &internal.URLAnalytics{}, &internal.BlockedDomain{}, &internal.ClickBatch{}); err != nil {
+		slog.Error("Failed to create database schema", "err", err)
+		os.Exit(1)
+	}
+
+	gen, err := idgen.New(1)
+	if err != nil {
+		slog.Error("Failed to create ID generator", "err", err)
+		os.Exit(1)
+	}
+
+	bots, err := internal.NewBotDetector(conf.Analytics.BotPatternsFile)
+	if err != nil {
+		slog.Error("Failed to load bot patterns", "err", err)
+		os.Exit(1)
+	}
+
+	links := internal.NewSQLLinkStore(DB)
+	cache := internal.NewMemoryCache()
+	events := internal.NewChannelPublisher(clickBufferSize)
+
+	agg := &aggregator{
+		links:     links,
+		cache:     cache,
+		bots:      bots,
+		retention: conf.Analytics.UniqueVisitorsRetention(),
+		batchSize: conf.Worker.BatchSize,
+		interval:  conf.Worker.FlushInterval,
+	}
+	go agg.run(events.Events())
+
+	cfg, err := api.NewConfig(conf)
+	if err != nil {
+		slog.Error("Failed to configure API", "err", err)
+		os.Exit(1)
+	}
+	cfg.NewID = func(ctx context.Context) (uint64, error) {
+		return gen.NextID()
+	}
+	cfg.Links = links
+	cfg.Cache = cache
+	cfg.Stats = cache
+	cfg.Limiter = cache
+	cfg.Events = events
+	cfg.Visitors = internal.NewVisitorHasher(cache)
+	cfg.Blocklist = internal.NewBlocklist(conf.Blocklist.File, internal.NewSQLBlocklistStore(DB))
+	if err := cfg.Blocklist.Reload(ctx); err != nil {
+		slog.Error("Failed to load blocklist", "err", err)
+		os.Exit(1)
+	}
+	api.Start(ctx, cfg)
+
+	app := api.NewApp(cfg)
+
+	slog.Info("Starting all-in-one URL shortener", "port", conf.App.Port)
+	if err := app.Listen(conf.App.Port); err != nil {
+		slog.Error("All-in-one URL shortener failed", "err", err)
+		os.Exit(1)
+	}
+}
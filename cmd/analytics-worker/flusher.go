@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/MagnunAVF/url-shortener/internal"
+	"github.com/MagnunAVF/url-shortener/internal/tracing"
+)
+
+const flushLockKey = "clicks:flush:lock"
+
+// Snapshot pending deltas, tagging the snapshot with batch ID ARGV[2],
+// unless a previous flush left its snapshot behind. Returns the ID of the
+// snapshot to flush, nil when there is nothing to flush.
+var snapshotScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[2]) == 0 then
+	if redis.call('EXISTS', KEYS[1]) == 0 then
+		return false
+	end
+	redis.call('RENAME', KEYS[1], KEYS[2])
+end
+redis.call('HSETNX', KEYS[2], ARGV[1], ARGV[2])
+return redis.call('HGET', KEYS[2], ARGV[1])
+`)
+
+// Delete the snapshot only if it is still batch ARGV[2]: with the lock
+// expired, another replica may have flushed it and taken the next one.
+var dropSnapshotScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], ARGV[1]) == ARGV[2] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+var unlockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// bufferCounts adds the batch deltas to the pending hash in Redis.
+func (w *Worker) bufferCounts(ctx context.Context, recs []internal.URLAnalytics) error {
+	pipe := w.Redis.TxPipeline()
+	for _, rec := range recs {
+		if rec.HumanClickCount > 0 {
+			pipe.HIncrBy(ctx, internal.PendingClicksKey, internal.PendingClickField(rec.ShortCode, internal.TrafficHuman), rec.HumanClickCount)
+		}
+		if rec.BotClickCount > 0 {
+			pipe.HIncrBy(ctx, internal.PendingClicksKey, internal.PendingClickField(rec.ShortCode, internal.TrafficBot), rec.BotClickCount)
+		}
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// runFlusher periodically moves pending deltas from Redis into url_analytics.
+func (w *Worker) runFlusher() {
+	ticker := time.NewTicker(w.RedisFlushInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx, span := tracing.Tracer().Start(context.Background(), "pending clicks flush")
+		if err := w.flushPending(ctx); err != nil {
+			slog.Error("Failed to flush pending click counts", "err", err)
+			tracing.Fail(span, err)
+		}
+		span.End()
+	}
+}
+
+// flushPending is safe to run concurrently and to retry: the snapshot's
+// batch ID is recorded along with its counts, in one transaction, so a
+// batch is never applied twice. The lock only saves replicas the work.
+func (w *Worker) flushPending(ctx context.Context) error {
+	// Only one worker replica flushes at a time
+	token, err := randomID()
+	if err != nil {
+		return err
+	}
+	ok, err := w.Redis.SetNX(ctx, flushLockKey, token, 4*w.RedisFlushInterval+30*time.Second).Result()
+	if err != nil || !ok {
+		return err
+	}
+	defer unlockScript.Run(ctx, w.Redis, []string{flushLockKey}, token)
+
+	newBatch, err := randomID()
+	if err != nil {
+		return err
+	}
+	batch, err := snapshotScript.Run(ctx, w.Redis, []string{internal.PendingClicksKey, internal.FlushingClicksKey},
+		internal.ClickBatchField, newBatch).Text()
+	if errors.Is(err, redis.Nil) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	fields, err := w.Redis.HGetAll(ctx, internal.FlushingClicksKey).Result()
+	if err != nil {
+		return err
+	}
+
+	counts := make(clickCounts)
+	for field, val := range fields {
+		i := strings.LastIndexByte(field, ':')
+		// Also skips ClickBatchField
+		if i < 0 {
+			continue
+		}
+		delta, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			slog.Warn("Skipping invalid pending click count", "field", field, "value", val)
+			continue
+		}
+		counts.add(field[:i], internal.TrafficClass(field[i+1:]), delta)
+	}
+
+	recs := counts.sorted()
+	start := time.Now()
+	applied, err := w.Links.ApplyClickBatch(ctx, batch, recs)
+	if err != nil {
+		// Snapshot stays in place and is retried on the next tick
+		return err
+	}
+
+	// Failing or crashing before this only leaves a snapshot the next flush
+	// finds already applied.
+	err = dropSnapshotScript.Run(ctx, w.Redis, []string{internal.FlushingClicksKey}, internal.ClickBatchField, batch).Err()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return err
+	}
+	if !applied {
+		slog.Info("Dropped pending click counts flushed before", "batch", batch)
+		return nil
+	}
+	batchDuration.WithLabelValues("redis_flush").Observe(time.Since(start).Seconds())
+	slog.Info("Flushed pending click counts", "short_codes", len(recs), "batch", batch)
+	return nil
+}
+
+func randomID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -1,26 +1,80 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"log/slog"
 	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/rabbitmq/amqp091-go"
-	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
-	"gorm.io/gorm/clause"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/MagnunAVF/url-shortener/internal"
+	"github.com/MagnunAVF/url-shortener/internal/config"
+	"github.com/MagnunAVF/url-shortener/internal/database"
+	"github.com/MagnunAVF/url-shortener/internal/health"
 	applog "github.com/MagnunAVF/url-shortener/internal/logger"
+	"github.com/MagnunAVF/url-shortener/internal/migrate"
+	"github.com/MagnunAVF/url-shortener/internal/tracing"
 )
 
-type ClickEvent struct {
-	ShortCode string    `json:"short_code"`
-	Timestamp time.Time `json:"timestamp"`
-	UserAgent string    `json:"user_agent"`
-	RequestID string    `json:"request_id,omitempty"`
+type Worker struct {
+	Links                   internal.LinkStore
+	Redis                   *redis.Client
+	Bots                    *internal.BotDetector
+	UniqueVisitorsRetention time.Duration
+	BatchSize               int
+	FlushInterval           time.Duration
+	Aggregation             string
+	RedisFlushInterval      time.Duration
+}
+
+// clickCounts aggregates click deltas per short code.
+type clickCounts map[string]*internal.URLAnalytics
+
+func (c clickCounts) add(shortCode string, class internal.TrafficClass, n int64) {
+	rec, ok := c[shortCode]
+	if !ok {
+		rec = &internal.URLAnalytics{ShortCode: shortCode}
+		c[shortCode] = rec
+	}
+	rec.ClickCount += n
+	if class == internal.TrafficBot {
+		rec.BotClickCount += n
+	} else {
+		rec.HumanClickCount += n
+	}
+}
+
+// sorted returns the counts ordered by short code, which keeps row lock
+// order stable across concurrent workers.
+func (c clickCounts) sorted() []internal.URLAnalytics {
+	recs := make([]internal.URLAnalytics, 0, len(c))
+	for _, rec := range c {
+		recs = append(recs, *rec)
+	}
+	sort.Slice(recs, func(i, j int) bool { return recs[i].ShortCode < recs[j].ShortCode })
+	return recs
+}
+
+type received struct {
+	event    internal.ClickEvent
+	delivery amqp091.Delivery
+	span     trace.SpanContext
+}
+
+type classifiedEvent struct {
+	internal.ClickEvent
+	Class internal.TrafficClass
 }
 
 func main() {
@@ -30,13 +84,62 @@ func main() {
 
 	applog.InitFromEnv()
 
-	writeDB, err := gorm.Open(postgres.Open(os.Getenv("DB_URL")), &gorm.Config{Logger: applog.NewGormLogger(os.Getenv("GORM_LOG_LEVEL"))})
+	ctx := context.Background()
+	shutdownTracing, err := tracing.Init(ctx, "analytics-worker")
+	if err != nil {
+		slog.Error("Failed to initialize tracing", "err", err)
+		os.Exit(1)
+	}
+	defer shutdownTracing(ctx)
+
+	conf, err := config.Load("DB_URL", "REDIS_ADDR", "RABBITMQ_URL", "CLICK_QUEUE_NAME")
+	if err != nil {
+		slog.Error("Invalid configuration", "err", err)
+		os.Exit(1)
+	}
+
+	// The worker only writes, so it never uses the DB_READ_URLS replicas
+	primary := conf.Postgres
+	primary.ReadURLs = nil
+	writeDB, err := database.OpenPostgres(primary)
 	if err != nil {
 		slog.Error("Unable to connect to primary database", "err", err)
 		os.Exit(1)
 	}
+	if err := migrate.Verify(ctx, writeDB); err != nil {
+		slog.Error("Database schema check failed", "err", err)
+		os.Exit(1)
+	}
 
-	rabbitConn, err := amqp091.Dial(os.Getenv("RABBITMQ_URL"))
+	rdb, err := database.NewRedis(conf.Redis)
+	if err != nil {
+		slog.Error("Unable to set up Redis", "err", err)
+		os.Exit(1)
+	}
+	if _, err := rdb.Ping(ctx).Result(); err != nil {
+		slog.Error("Unable to connect to Redis", "err", err)
+		os.Exit(1)
+	}
+	defer rdb.Close()
+
+	bots, err := internal.NewBotDetector(conf.Analytics.BotPatternsFile)
+	if err != nil {
+		slog.Error("Failed to load bot patterns", "err", err)
+		os.Exit(1)
+	}
+
+	w := &Worker{
+		Links:                   internal.NewSQLLinkStore(writeDB),
+		Redis:                   rdb,
+		Bots:                    bots,
+		UniqueVisitorsRetention: conf.Analytics.UniqueVisitorsRetention(),
+		BatchSize:               conf.Worker.BatchSize,
+		FlushInterval:           conf.Worker.FlushInterval,
+		Aggregation:             conf.Worker.Aggregation,
+		RedisFlushInterval:      conf.Worker.RedisFlushInterval,
+	}
+
+	rabbitConn, err := amqp091.Dial(conf.RabbitMQ.URL)
 	if err != nil {
 		slog.Error("Unable to connect to RabbitMQ", "err", err)
 		os.Exit(1)
@@ -51,7 +154,7 @@ func main() {
 	defer rabbitCH.Close()
 
 	q, err := rabbitCH.QueueDeclare(
-		os.Getenv("CLICK_QUEUE_NAME"),
+		conf.RabbitMQ.ClickQueue,
 		true, false, false, false, nil,
 	)
 	if err != nil {
@@ -59,121 +162,252 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Set prefetch to 100. This worker will grab 100 messages at a time.
-	if err := rabbitCH.Qos(100, 0, false); err != nil {
-		slog.Error("Failed to set QoS", "err", err)
-		os.Exit(1)
+	prefetch := conf.Worker.Prefetch
+	consumers := conf.Worker.Consumers
+
+	// Consumers decode in parallel and feed a single batching stage, so one
+	// batch can aggregate clicks received by every consumer.
+	incoming := make(chan received, prefetch*consumers)
+	var wg sync.WaitGroup
+	for i := 0; i < consumers; i++ {
+		// One channel per consumer: prefetch is applied per channel and
+		// deliveries are acked on the channel they came from.
+		ch, err := rabbitConn.Channel()
+		if err != nil {
+			slog.Error("Unable to open RabbitMQ channel", "consumer", i, "err", err)
+			os.Exit(1)
+		}
+		defer ch.Close()
+
+		if err := ch.Qos(prefetch, 0, false); err != nil {
+			slog.Error("Failed to set QoS", "consumer", i, "err", err)
+			os.Exit(1)
+		}
+
+		msgs, err := ch.Consume(
+			q.Name, "", false, false, false, false, nil,
+		)
+		if err != nil {
+			slog.Error("Failed to register consumer", "consumer", i, "err", err)
+			os.Exit(1)
+		}
+
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			consume(id, msgs, incoming)
+		}(i)
 	}
+	go func() {
+		wg.Wait()
+		close(incoming)
+	}()
 
-	msgs, err := rabbitCH.Consume(
-		q.Name, "", false, false, false, false, nil,
+	slog.Info("Analytics Worker started. Waiting for click events...",
+		"consumers", consumers,
+		"prefetch", prefetch,
+		"batch_size", w.BatchSize,
+		"flush_interval", w.FlushInterval.String(),
+		"aggregation", w.Aggregation,
 	)
-	if err != nil {
-		slog.Error("Failed to register consumer", "err", err)
-		os.Exit(1)
+
+	if w.Aggregation == config.AggregateRedis {
+		go w.runFlusher()
 	}
+	checker := health.NewChecker()
+	checker.Add("postgres", health.Postgres(writeDB))
+	checker.Add("redis", health.Redis(rdb))
+	checker.Add("consumers", func(ctx context.Context) error {
+		if n := activeConsumers.Load(); n < int32(consumers) {
+			return fmt.Errorf("%d of %d consumers running", n, consumers)
+		}
+		return nil
+	})
+	go serveHTTP(conf.Worker.MetricsPort, conf.HTTP, checker)
+	go watchQueueDepth(rabbitCH, q.Name)
+
+	w.runBatcher(incoming)
+
+	// Let the restart policy bring us back with fresh connections
+	slog.Error("All RabbitMQ consumers stopped, exiting")
+	os.Exit(1)
+}
 
-	slog.Info("Analytics Worker started. Waiting for click events...")
+// activeConsumers counts consumers still reading from their channel.
+var activeConsumers atomic.Int32
 
-	var events []ClickEvent
+func consume(id int, msgs <-chan amqp091.Delivery, out chan<- received) {
+	activeConsumers.Add(1)
+	defer activeConsumers.Add(-1)
+
+	for d := range msgs {
+		var event internal.ClickEvent
+		if err := json.Unmarshal(d.Body, &event); err != nil {
+			slog.Error("Error decoding message. Rejecting.", "consumer", id, "err", err)
+			// 'false' means don't re-queue
+			d.Reject(false)
+			deliveriesHandled.WithLabelValues("reject").Inc()
+			continue
+		}
+		slog.Info("received click event", "consumer", id, "short_code", event.ShortCode, "request_id", event.RequestID)
+
+		// Continue the trace started by the redirect; the batch span links
+		// back to this one.
+		ctx := tracing.ExtractAMQP(context.Background(), d.Headers)
+		_, span := tracing.Tracer().Start(ctx, d.RoutingKey+" receive",
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(
+				semconv.MessagingSystemRabbitMQ,
+				semconv.MessagingOperationTypeReceive,
+				semconv.MessagingDestinationName(d.RoutingKey),
+				attribute.String("request_id", event.RequestID),
+			),
+		)
+		span.End()
+
+		out <- received{event: event, delivery: d, span: span.SpanContext()}
+	}
+	slog.Warn("RabbitMQ channel closed", "consumer", id)
+}
+
+func (w *Worker) runBatcher(incoming <-chan received) {
+	var events []internal.ClickEvent
 	var deliveries []amqp091.Delivery
+	var links []trace.Link
 
-	// Batch process every 2 seconds
-	ticker := time.NewTicker(2 * time.Second)
+	ticker := time.NewTicker(w.FlushInterval)
+	defer ticker.Stop()
 
-	go func() {
-		for {
-			select {
-			case d, ok := <-msgs:
-				if !ok {
-					slog.Warn("RabbitMQ channel closed")
-					return
-				}
-				var event ClickEvent
-				if err := json.Unmarshal(d.Body, &event); err != nil {
-					slog.Error("Error decoding message. Rejecting.", "err", err)
-					// 'false' means don't re-queue
-					d.Reject(false)
-					continue
-				}
-				slog.Info("received click event", "short_code", event.ShortCode, "request_id", event.RequestID)
-				events = append(events, event)
-				deliveries = append(deliveries, d)
-
-				// Process if batch is full
-				if len(events) >= 100 {
-					processBatch(writeDB, events, deliveries)
-					events, deliveries = nil, nil
-					ticker.Reset(2 * time.Second)
-				}
-
-			// Process on a timer
-			case <-ticker.C:
-				if len(events) > 0 {
-					slog.Info("Timer flush: processing queued events", "count", len(events))
-					processBatch(writeDB, events, deliveries)
-					events, deliveries = nil, nil
-				}
+	for {
+		select {
+		case r, ok := <-incoming:
+			if !ok {
+				// Pending deliveries can't be acked on closed channels;
+				// the broker will redeliver them.
+				return
+			}
+			events = append(events, r.event)
+			deliveries = append(deliveries, r.delivery)
+			links = append(links, trace.Link{SpanContext: r.span})
+
+			// Process if batch is full
+			if len(events) >= w.BatchSize {
+				w.processBatch(events, deliveries, links)
+				events, deliveries, links = nil, nil, nil
+				ticker.Reset(w.FlushInterval)
 			}
-		}
-	}()
 
-	// Block forever without using a nil channel
-	select {}
+		// Process on a timer
+		case <-ticker.C:
+			if len(events) > 0 {
+				slog.Info("Timer flush: processing queued events", "count", len(events))
+				w.processBatch(events, deliveries, links)
+				events, deliveries, links = nil, nil, nil
+			}
+		}
+	}
 }
 
-func processBatch(db *gorm.DB, events []ClickEvent, deliveries []amqp091.Delivery) {
+func (w *Worker) processBatch(events []internal.ClickEvent, deliveries []amqp091.Delivery, links []trace.Link) {
 	if len(events) == 0 {
 		return
 	}
+	ctx, span := tracing.Tracer().Start(context.Background(), "click batch process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithLinks(links...),
+		trace.WithAttributes(
+			semconv.MessagingSystemRabbitMQ,
+			semconv.MessagingOperationTypeProcess,
+			semconv.MessagingBatchMessageCount(len(events)),
+		),
+	)
+	defer span.End()
 	slog.Info("Processing batch of events", "count", len(events))
+	start := time.Now()
+	batchSize.Observe(float64(len(events)))
+	for _, event := range events {
+		eventLag.Observe(start.Sub(event.Timestamp).Seconds())
+	}
 
-	counts := make(map[string]int64)
+	classified := make([]classifiedEvent, 0, len(events))
 	for _, event := range events {
-		counts[event.ShortCode]++
-	}
-
-	err := db.Transaction(func(tx *gorm.DB) error {
-		for shortCode, count := range counts {
-			// Upsert: insert initial count, or increment existing count atomically
-			rec := internal.URLAnalytics{ShortCode: shortCode, ClickCount: count}
-			if err := tx.Clauses(
-				clause.OnConflict{
-					Columns: []clause.Column{{Name: "short_code"}},
-					DoUpdates: clause.Assignments(map[string]interface{}{
-						"click_count": gorm.Expr("url_analytics.click_count + EXCLUDED.click_count"),
-					}),
-				},
-			).Create(&rec).Error; err != nil {
-				slog.Error("Error upserting click count", "short_code", shortCode, "err", err)
-				return err
-			}
-		}
-		slog.Info("Successfully processed batch", "count", len(events))
-		return nil
-	})
+		class := w.Bots.Classify(internal.ClickSignals{
+			Method:    event.Method,
+			UserAgent: event.UserAgent,
+			Accept:    event.Accept,
+			Purpose:   event.Purpose,
+		})
+		classified = append(classified, classifiedEvent{ClickEvent: event, Class: class})
+	}
+
+	// PFADD is idempotent, so running it before the upsert is safe:
+	// redelivered events after a nack never inflate unique visitors.
+	if err := w.addUniqueVisitors(ctx, classified); err != nil {
+		slog.Error("Failed to record unique visitors. Nacking messages.", "err", err)
+		tracing.Fail(span, err)
+		nackAll(deliveries)
+		return
+	}
+
+	counts := make(clickCounts)
+	for _, event := range classified {
+		counts.add(event.ShortCode, event.Class, 1)
+	}
 
-	// Nack in transaction error
+	var err error
+	if w.Aggregation == config.AggregateRedis {
+		err = w.bufferCounts(ctx, counts.sorted())
+	} else {
+		err = w.Links.AddClicks(ctx, counts.sorted())
+	}
+
+	// Nack on write error
 	if err != nil {
-		slog.Error("Failed to process batch transaction. Nacking messages.", "err", err)
+		slog.Error("Failed to record click counts. Nacking messages.", "err", err)
+		tracing.Fail(span, err)
 		// Re-queue messages for another try
 		nackAll(deliveries)
 		return
 	}
 
-	// ack in transaction success
+	// ack on write success
+	batchDuration.WithLabelValues("batch").Observe(time.Since(start).Seconds())
 	ackAll(deliveries)
 	slog.Info("Successfully processed and acked messages", "count", len(deliveries))
 }
 
+func (w *Worker) addUniqueVisitors(ctx context.Context, events []classifiedEvent) error {
+	visitors := make(map[string][]interface{})
+	for _, event := range events {
+		if event.VisitorID == "" {
+			continue
+		}
+		key := internal.UniqueVisitorsKey(event.ShortCode, event.Class, internal.VisitorDay(event.Timestamp))
+		visitors[key] = append(visitors[key], event.VisitorID)
+	}
+	if len(visitors) == 0 {
+		return nil
+	}
+
+	pipe := w.Redis.Pipeline()
+	for key, ids := range visitors {
+		pipe.PFAdd(ctx, key, ids...)
+		pipe.Expire(ctx, key, w.UniqueVisitorsRetention)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
 func ackAll(deliveries []amqp091.Delivery) {
 	for _, d := range deliveries {
 		d.Ack(false)
 	}
+	deliveriesHandled.WithLabelValues("ack").Add(float64(len(deliveries)))
 }
 
 func nackAll(deliveries []amqp091.Delivery) {
 	for _, d := range deliveries {
 		d.Nack(false, true)
 	}
+	deliveriesHandled.WithLabelValues("nack").Add(float64(len(deliveries)))
 }
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rabbitmq/amqp091-go"
+
+	"github.com/MagnunAVF/url-shortener/internal/config"
+	"github.com/MagnunAVF/url-shortener/internal/health"
+)
+
+const queueDepthInterval = 15 * time.Second
+
+var (
+	batchSize = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "worker_batch_size",
+		Help:    "Click events per processed batch.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+	})
+
+	batchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "worker_flush_duration_seconds",
+		Help:    "Time spent writing click counts, by stage (batch, redis_flush).",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"stage"})
+
+	deliveriesHandled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "worker_deliveries_total",
+		Help: "RabbitMQ deliveries settled, by outcome (ack, nack, reject).",
+	}, []string{"outcome"})
+
+	eventLag = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "worker_event_lag_seconds",
+		Help:    "Time between a click and its batch being processed.",
+		Buckets: []float64{.1, .5, 1, 2.5, 5, 10, 30, 60, 300, 900, 3600},
+	})
+
+	queueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "worker_queue_messages_ready",
+		Help: "Messages waiting in the click queue.",
+	})
+)
+
+// serveHTTP exposes metrics and health probes on addr; the worker has no
+// other HTTP surface.
+func serveHTTP(addr string, conf config.HTTP, checker *health.Checker) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	checker.RegisterHTTP(mux)
+
+	srv := &http.Server{
+		Addr:         addr,
+		Handler:      mux,
+		ReadTimeout:  conf.ReadTimeout,
+		WriteTimeout: conf.WriteTimeout,
+		IdleTimeout:  conf.IdleTimeout,
+	}
+	slog.Info("Starting metrics and health listener", "port", addr)
+	if err := srv.ListenAndServe(); err != nil {
+		slog.Error("Metrics and health listener failed", "err", err)
+	}
+}
+
+// watchQueueDepth periodically samples the ready message count of queue.
+func watchQueueDepth(ch *amqp091.Channel, queue string) {
+	ticker := time.NewTicker(queueDepthInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		q, err := ch.QueueDeclarePassive(queue, true, false, false, false, nil)
+		if err != nil {
+			slog.Error("Failed to inspect queue", "queue", queue, "err", err)
+			return
+		}
+		queueDepth.Set(float64(q.Messages))
+	}
+}
@@ -3,41 +3,25 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
-	"strconv"
-	"time"
 
 	"github.com/MagnunAVF/url-shortener/internal"
+	"github.com/MagnunAVF/url-shortener/internal/api"
+	"github.com/MagnunAVF/url-shortener/internal/config"
+	"github.com/MagnunAVF/url-shortener/internal/database"
 	applog "github.com/MagnunAVF/url-shortener/internal/logger"
-	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/MagnunAVF/url-shortener/internal/migrate"
+	"github.com/MagnunAVF/url-shortener/internal/tracing"
 	"github.com/joho/godotenv"
 	"github.com/rabbitmq/amqp091-go"
-	"github.com/redis/go-redis/v9"
-	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
-type Config struct {
-	AppDomain    string
-	ClickQueue   string
-	IDServiceURL string
-	Redis        *redis.Client
-	DB           *gorm.DB
-	RabbitMQ     *amqp091.Channel
-}
-
-type ClickEvent struct {
-	ShortCode string    `json:"short_code"`
-	Timestamp time.Time `json:"timestamp"`
-	UserAgent string    `json:"user_agent"`
-	RequestID string    `json:"request_id,omitempty"`
-}
-
 func main() {
 	if err := godotenv.Load(".env"); err != nil {
 		slog.Warn(".env file not found, relying on env vars", "err", err)
@@ -46,150 +30,58 @@ func main() {
 	applog.InitFromEnv()
 
 	ctx := context.Background()
-	cfg := loadConfig(ctx)
+	shutdownTracing, err := tracing.Init(ctx, "api-service")
+	if err != nil {
+		slog.Error("Failed to initialize tracing", "err", err)
+		os.Exit(1)
+	}
+	defer shutdownTracing(ctx)
 
-	slog.Info("Running GORM Auto-Migration...")
-	err := cfg.DB.AutoMigrate(&internal.URL{}, &internal.URLAnalytics{})
+	conf, err := config.Load("DB_URL", "REDIS_ADDR", "RABBITMQ_URL", "CLICK_QUEUE_NAME")
 	if err != nil {
-		slog.Error("Failed to auto-migrate database", "err", err)
+		slog.Error("Invalid configuration", "err", err)
 		os.Exit(1)
 	}
-	slog.Info("Migration complete.")
 
-	app := fiber.New()
-	app.Use(applog.FiberMiddleware())
-	app.Use(cors.New())
+	cfg := loadConfig(ctx, conf)
+	api.Start(ctx, cfg)
 
-	app.Get("/:short_code", handleRedirect(cfg))
-	app.Post("/shorten", handleShorten(cfg))
-	app.Get("/stats/:short_code", handleGetStats(cfg))
+	app := api.NewApp(cfg)
 
-	slog.Info("Starting API Service", "port", os.Getenv("API_SERVICE_PORT"))
-	if err := app.Listen(os.Getenv("API_SERVICE_PORT")); err != nil {
+	slog.Info("Starting API Service", "port", conf.App.Port)
+	if err := app.Listen(conf.App.Port); err != nil {
 		slog.Error("API Service failed", "err", err)
 		os.Exit(1)
 	}
 }
 
-func handleRedirect(cfg *Config) fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		shortCode := c.Params("short_code")
-		reqID := c.Locals("request_id").(string)
-		ctx := applog.WithRequestID(context.Background(), reqID)
-
-		cacheKey := "url:" + shortCode
-		longURL, err := cfg.Redis.Get(ctx, cacheKey).Result()
-
-		if err == redis.Nil {
-			var url internal.URL
-			err = cfg.DB.WithContext(ctx).Select("long_url").Where("short_code = ?", shortCode).First(&url).Error
-			if errors.Is(err, gorm.ErrRecordNotFound) {
-				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Short URL not found"})
-			} else if err != nil {
-				slog.Error("DB error", "err", err)
-				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
-			}
-
-			longURL = url.LongURL
-
-			if err := cfg.Redis.Set(ctx, cacheKey, longURL, 1*time.Hour).Err(); err != nil {
-				slog.Error("Error setting cache", "err", err)
-			}
-		} else if err != nil {
-			slog.Error("Error reading cache", "err", err)
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Cache error"})
-		}
-
-		userAgent := c.Get("User-Agent")
-		if userAgent == "" {
-			userAgent = "Unknown"
-		}
-		go publishClickEvent(cfg, shortCode, userAgent, reqID)
-
-		return c.Redirect(longURL, fiber.StatusFound)
+func loadConfig(ctx context.Context, conf *config.Config) *api.Config {
+	DB, err := database.OpenPostgres(conf.Postgres)
+	if err != nil {
+		slog.Error("Unable to connect to database", "err", err)
+		os.Exit(1)
 	}
-}
-
-func handleShorten(cfg *Config) fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		var req struct {
-			URL string `json:"url"`
-		}
-		if err := c.BodyParser(&req); err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
-		}
-		if req.URL == "" {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "URL cannot be empty"})
-		}
-
-		reqID, _ := c.Locals("request_id").(string)
-		ctx := applog.WithRequestID(context.Background(), reqID)
-
-		var existingURL internal.URL
-		err := cfg.DB.WithContext(ctx).Select("short_code").Where("long_url = ?", req.URL).First(&existingURL).Error
-		if err == nil {
-			return c.JSON(fiber.Map{
-				"short_url": fmt.Sprintf("%s/%s", cfg.AppDomain, existingURL.ShortCode),
-			})
-		}
-
-		id, err := getNewID(cfg.IDServiceURL)
-		if err != nil {
-			slog.Error("Error getting new ID", "err", err, "request_id", reqID)
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not generate ID"})
-		}
-
-		shortCode := internal.EncodeID(id)
-
-		newURL := internal.URL{
-			ID:        int64(id), // TODO: improve this id type. at this time, tmp cast this value
-			ShortCode: shortCode,
-			LongURL:   req.URL,
-		}
-
-		err = cfg.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-			if err := tx.Create(&newURL).Error; err != nil {
-				return err
-			}
-			return nil
-		})
-
-		if err != nil {
-			slog.Error("Error creating short URL", "err", err, "request_id", reqID)
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not save URL"})
-		}
-
-		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-			"short_url": fmt.Sprintf("%s/%s", cfg.AppDomain, shortCode),
-		})
+	if len(conf.Postgres.ReadURLs) > 0 {
+		slog.Info("Routing database reads to replicas", "replicas", len(conf.Postgres.ReadURLs))
 	}
-}
-
-func handleGetStats(cfg *Config) fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		return c.SendString("Returning from handleGetStats")
+	// Schema changes are applied by the migrate command, never by replicas
+	if err := migrate.Verify(ctx, DB); err != nil {
+		slog.Error("Database schema check failed", "err", err)
+		os.Exit(1)
 	}
-}
 
-func loadConfig(ctx context.Context) *Config {
-	DB, err := gorm.Open(postgres.Open(os.Getenv("DB_URL")), &gorm.Config{Logger: applog.NewGormLogger(os.Getenv("GORM_LOG_LEVEL"))})
+	rdb, err := database.NewRedis(conf.Redis)
 	if err != nil {
-		slog.Error("Unable to connect to database", "err", err)
+		slog.Error("Unable to set up Redis", "err", err)
 		os.Exit(1)
 	}
-
-	redisDB, _ := strconv.Atoi(os.Getenv("REDIS_DB"))
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     os.Getenv("REDIS_ADDR"),
-		Password: os.Getenv("REDIS_PASSWORD"),
-		DB:       redisDB,
-	})
+	// Redis is an optimization: start without it, the client reconnects on
+	// its own and redirects are served from Postgres meanwhile.
 	if _, err := rdb.Ping(ctx).Result(); err != nil {
-		slog.Error("Unable to connect to Redis", "err", err)
-		os.Exit(1)
+		slog.Warn("Redis unavailable at startup, running degraded", "err", err)
 	}
 
-	rabbitConn, err := amqp091.Dial(os.Getenv("RABBITMQ_URL"))
+	rabbitConn, err := amqp091.Dial(conf.RabbitMQ.URL)
 	if err != nil {
 		slog.Error("Unable to connect to RabbitMQ", "err", err)
 		os.Exit(1)
@@ -200,7 +92,7 @@ func loadConfig(ctx context.Context) *Config {
 		os.Exit(1)
 	}
 
-	queueName := os.Getenv("CLICK_QUEUE_NAME")
+	queueName := conf.RabbitMQ.ClickQueue
 	_, err = rabbitCH.QueueDeclare(
 		queueName,
 		true,  // durable
@@ -214,20 +106,49 @@ func loadConfig(ctx context.Context) *Config {
 		os.Exit(1)
 	}
 
-	IDServiceURL := "http://" + os.Getenv("ID_SERVICE_DOMAIN") + os.Getenv("ID_SERVICE_PORT") + "/new-id"
+	IDServiceBaseURL := conf.IDService.BaseURL()
+	IDClient := &http.Client{Timeout: conf.IDService.Timeout}
+	cache := internal.NewRedisCache(rdb)
 
-	return &Config{
-		AppDomain:    os.Getenv("APP_DOMAIN"),
-		ClickQueue:   queueName,
-		IDServiceURL: IDServiceURL,
-		Redis:        rdb,
-		DB:           DB,
-		RabbitMQ:     rabbitCH,
+	cfg, err := api.NewConfig(conf)
+	if err != nil {
+		slog.Error("Failed to configure API", "err", err)
+		os.Exit(1)
+	}
+	cfg.NewID = func(ctx context.Context) (uint64, error) {
+		return getNewID(ctx, IDClient, IDServiceBaseURL+"/new-id")
+	}
+	cfg.IDServiceHealthURL = IDServiceBaseURL + "/livez"
+	cfg.Links = internal.NewSQLLinkStore(DB)
+	cfg.Cache = cache
+	cfg.Stats = cache
+	cfg.Limiter = cache
+	cfg.Events = internal.NewAMQPPublisher(rabbitCH, queueName)
+	cfg.Visitors = internal.NewVisitorHasher(cache)
+	cfg.Blocklist = internal.NewBlocklist(conf.Blocklist.File, internal.NewSQLBlocklistStore(DB))
+	if err := cfg.Blocklist.Reload(ctx); err != nil {
+		slog.Error("Failed to load blocklist", "err", err)
+		os.Exit(1)
 	}
+	return cfg
 }
 
-func getNewID(serviceURL string) (uint64, error) {
-	resp, err := http.Get(serviceURL)
+func getNewID(ctx context.Context, client *http.Client, serviceURL string) (id uint64, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "id-service new-id", trace.WithSpanKind(trace.SpanKindClient))
+	defer func() {
+		if err != nil {
+			tracing.Fail(span, err)
+		}
+		span.End()
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, serviceURL, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to build ID service request: %w", err)
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := client.Do(req)
 	if err != nil {
 		return 0, fmt.Errorf("failed to call ID service: %w", err)
 	}
@@ -243,30 +164,3 @@ func getNewID(serviceURL string) (uint64, error) {
 	}
 	return data.ID, nil
 }
-
-func publishClickEvent(cfg *Config, shortCode, userAgent, requestID string) {
-	event := ClickEvent{
-		ShortCode: shortCode,
-		Timestamp: time.Now(),
-		UserAgent: userAgent,
-		RequestID: requestID,
-	}
-	slog.Info("Publishing click event", "event", event)
-
-	body, err := json.Marshal(event)
-	if err != nil {
-		slog.Error("Error marshalling click event", "err", err)
-		return
-	}
-	err = cfg.RabbitMQ.PublishWithContext(
-		context.Background(),
-		"", cfg.ClickQueue, false, false,
-		amqp091.Publishing{
-			ContentType: "application/json",
-			Body:        body,
-		},
-	)
-	if err != nil {
-		slog.Error("Error publishing click event", "err", err)
-	}
-}
@@ -0,0 +1,85 @@
+package main
+
+// Applies the versioned SQL migrations embedded in internal/migrate.
+//
+// Usage:
+//
+//	migrate [up]      apply every pending migration (default)
+//	migrate down [n]  roll back the last n migrations (default 1)
+//	migrate version   print the applied and latest versions
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+
+	"github.com/joho/godotenv"
+
+	"github.com/MagnunAVF/url-shortener/internal/config"
+	"github.com/MagnunAVF/url-shortener/internal/database"
+	applog "github.com/MagnunAVF/url-shortener/internal/logger"
+	"github.com/MagnunAVF/url-shortener/internal/migrate"
+)
+
+func main() {
+	if err := godotenv.Load(".env"); err != nil {
+		slog.Warn(".env file not found, relying on env vars", "err", err)
+	}
+
+	applog.InitFromEnv()
+
+	conf, err := config.Load("DB_URL")
+	if err != nil {
+		slog.Error("Invalid configuration", "err", err)
+		os.Exit(1)
+	}
+
+	// Migrations run against the primary and may legitimately take long
+	primary := conf.Postgres
+	primary.ReadURLs = nil
+	primary.StatementTimeout = 0
+	db, err := database.OpenPostgres(primary)
+	if err != nil {
+		slog.Error("Unable to connect to database", "err", err)
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+	cmd := "up"
+	if len(os.Args) > 1 {
+		cmd = os.Args[1]
+	}
+
+	switch cmd {
+	case "up":
+		err = migrate.Up(ctx, db)
+	case "down":
+		steps := 1
+		if len(os.Args) > 2 {
+			steps, err = strconv.Atoi(os.Args[2])
+			if err != nil || steps <= 0 {
+				slog.Error("down expects a positive number of steps", "value", os.Args[2])
+				os.Exit(2)
+			}
+		}
+		err = migrate.Down(ctx, db, steps)
+	case "version":
+		var current, latest int64
+		if current, err = migrate.Version(ctx, db); err == nil {
+			if latest, err = migrate.Latest(); err == nil {
+				fmt.Printf("current: %d\nlatest: %d\n", current, latest)
+			}
+		}
+	default:
+		slog.Error("Unknown command, expected up, down or version", "command", cmd)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		slog.Error("Migration failed", "command", cmd, "err", err)
+		os.Exit(1)
+	}
+	slog.Info("Migration command complete", "command", cmd)
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/MagnunAVF/url-shortener/internal"
+	applog "github.com/MagnunAVF/url-shortener/internal/logger"
+)
+
+// registerAdmin mounts the management endpoints under /admin, guarded by
+// cfg.AdminToken. Without a token they aren't mounted at all.
+func registerAdmin(app *fiber.App, cfg *Config) {
+	if cfg.AdminToken == "" {
+		return
+	}
+	admin := app.Group("/admin", adminAuth(cfg.AdminToken))
+	admin.Get("/blocklist", handleListBlocklist(cfg))
+	admin.Post("/blocklist", handleBlock(cfg))
+	admin.Delete("/blocklist/:pattern", handleUnblock(cfg))
+	admin.Patch("/links/:short_code", handleUpdateLink(cfg))
+}
+
+func adminAuth(token string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		given, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+		return c.Next()
+	}
+}
+
+// handleListBlocklist lists the file entries too, flagged by their source;
+// only stored ones can be removed through the API.
+func handleListBlocklist(cfg *Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"entries": cfg.Blocklist.Entries()})
+	}
+}
+
+func handleBlock(cfg *Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req struct {
+			Pattern string `json:"pattern"`
+			Reason  string `json:"reason"`
+		}
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+		}
+		pattern, err := internal.NormalizePattern(req.Pattern)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		reqID, _ := c.Locals("request_id").(string)
+		ctx := applog.WithRequestID(c.UserContext(), reqID)
+
+		entry := internal.BlockedDomain{Pattern: pattern, Reason: strings.TrimSpace(req.Reason)}
+		if err := cfg.Blocklist.Store().Block(ctx, &entry); err != nil {
+			slog.Error("Error blocking domain", "err", err, "request_id", reqID)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not save blocklist entry"})
+		}
+		slog.Info("Domain blocked", "pattern", pattern, "reason", entry.Reason, "request_id", reqID)
+		notifyBlocklistChanged(ctx, cfg)
+
+		entry.Source = internal.BlockSourceStore
+		return c.Status(fiber.StatusCreated).JSON(entry)
+	}
+}
+
+func handleUnblock(cfg *Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		raw, err := url.PathUnescape(c.Params("pattern"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid pattern"})
+		}
+		pattern, err := internal.NormalizePattern(raw)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		reqID, _ := c.Locals("request_id").(string)
+		ctx := applog.WithRequestID(c.UserContext(), reqID)
+
+		err = cfg.Blocklist.Store().Unblock(ctx, pattern)
+		if errors.Is(err, internal.ErrNotBlocked) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Pattern is not blocked"})
+		} else if err != nil {
+			slog.Error("Error unblocking domain", "err", err, "request_id", reqID)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not remove blocklist entry"})
+		}
+		slog.Info("Domain unblocked", "pattern", pattern, "request_id", reqID)
+		notifyBlocklistChanged(ctx, cfg)
+
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+// handleUpdateLink changes the attributes of a link, e.g. flagging it as
+// risky so redirects show the interstitial or retagging its UTM
+// parameters.
+func handleUpdateLink(cfg *Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		shortCode := c.Params("short_code")
+		var req struct {
+			Interstitial *bool `json:"interstitial"`
+			// Replaces the whole set; {} clears it
+			UTM *internal.UTM `json:"utm"`
+		}
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+		}
+		if req.UTM != nil {
+			utm, err := req.UTM.Normalize()
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+			}
+			req.UTM = &utm
+		}
+
+		reqID, _ := c.Locals("request_id").(string)
+		ctx := applog.WithRequestID(c.UserContext(), reqID)
+
+		link, err := cfg.Links.UpdateLink(ctx, shortCode, internal.LinkUpdate{Interstitial: req.Interstitial, UTM: req.UTM})
+		if errors.Is(err, internal.ErrLinkNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Short URL not found"})
+		} else if err != nil {
+			slog.Error("Error updating link", "err", err, "request_id", reqID)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update link"})
+		}
+		if err := refreshLink(ctx, cfg, link); err != nil {
+			slog.Error("Error refreshing cached link", "err", err, "request_id", reqID)
+		}
+
+		return c.JSON(fiber.Map{
+			"short_code":   link.ShortCode,
+			"long_url":     link.LongURL,
+			"protected":    link.PasswordHash != "",
+			"interstitial": link.Interstitial,
+			"utm":          link.UTM,
+			"created_at":   link.CreatedAt,
+		})
+	}
+}
@@ -0,0 +1,566 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/MagnunAVF/url-shortener/internal"
+	"github.com/MagnunAVF/url-shortener/internal/config"
+	"github.com/MagnunAVF/url-shortener/internal/health"
+	applog "github.com/MagnunAVF/url-shortener/internal/logger"
+	"github.com/MagnunAVF/url-shortener/internal/metrics"
+	"github.com/MagnunAVF/url-shortener/internal/tracing"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/hashicorp/golang-lru/v2/expirable"
+)
+
+const (
+	defaultStatsDays = 7
+	maxStatsDays     = 90
+
+	defaultUTMStatsLimit = 50
+	maxUTMStatsLimit     = 500
+)
+
+type Config struct {
+	AppDomain string
+	HTTP      config.HTTP
+	URLs      internal.URLPolicy
+	// Host of AppDomain; destinations on it are resolved to their target
+	SelfHost string
+	// Other shorteners' domains, see unwrapDestination
+	Shorteners       map[string]bool
+	UnwrapShorteners bool
+	UnwrapClient     *http.Client
+	// Hands out the IDs short codes are encoded from
+	NewID func(ctx context.Context) (uint64, error)
+	// Liveness endpoint of the ID service, used by readiness checks. Empty
+	// skips the check.
+	IDServiceHealthURL string
+	Links              internal.LinkStore
+	Cache              internal.Cache
+	Stats              internal.ClickStats
+	Events             internal.EventPublisher
+	Visitors           *internal.VisitorHasher
+	RedisBreaker       *internal.CircuitBreaker
+	LocalCache         *expirable.LRU[string, cachedLink]
+	// Never built when the Bloom filter is disabled, letting every code through
+	Codes                *codeFilter
+	BloomRebuildInterval time.Duration
+	// Zero disables cache warming
+	CacheWarmTopN     int
+	CacheWarmInterval time.Duration
+	// Loaded by the caller before Start; its store backs the admin API
+	Blocklist               *internal.Blocklist
+	BlocklistReloadInterval time.Duration
+	// Empty disables the /admin endpoints
+	AdminToken string
+	// Nil disables rate limiting
+	Limiter       internal.RateLimiter
+	ShortenLimit  internal.RateLimit
+	RedirectLimit internal.RateLimit
+	// Known X-API-Key values, see clientKey
+	APIKeys map[string]bool
+	// Signs the cookies unlocking password-protected links
+	CookieSecret  []byte
+	SecureCookies bool
+	UnlockTTL     time.Duration
+	// Password attempts per client and link
+	UnlockLimit internal.RateLimit
+}
+
+// Redirect statuses links may be created with
+var redirectStatuses = map[int]bool{
+	fiber.StatusMovedPermanently:  true,
+	fiber.StatusFound:             true,
+	fiber.StatusTemporaryRedirect: true,
+	fiber.StatusPermanentRedirect: true,
+}
+
+// Headers browsers and unfurlers use to flag prefetches and link previews
+var purposeHeaders = []string{"Sec-Purpose", "Purpose", "X-Purpose", "X-Moz"}
+
+// NewConfig builds the API configuration from the service configuration.
+// Dependencies (Links, Cache, Stats, Events, Visitors, Blocklist, Limiter
+// and NewID) are left for the caller to wire.
+func NewConfig(c *config.Config) (*Config, error) {
+	cfg := &Config{
+		AppDomain:               c.App.Domain,
+		HTTP:                    c.HTTP,
+		URLs:                    internal.URLPolicy{MaxLength: c.Links.MaxURLLength},
+		SelfHost:                selfHost(c.App.Domain),
+		Shorteners:              make(map[string]bool, len(c.Links.Shorteners)),
+		UnwrapShorteners:        c.Links.ShortenerPolicy == config.ShortenerUnwrap,
+		UnwrapClient:            newUnwrapClient(c.Links.UnwrapTimeout),
+		LocalCache:              newLocalCache(c.Cache.LocalSize, c.Cache.LocalTTL),
+		Codes:                   newCodeFilter(c.Cache.BloomFalsePositive),
+		CacheWarmTopN:           c.Cache.WarmTopN,
+		CacheWarmInterval:       c.Cache.WarmInterval,
+		BlocklistReloadInterval: c.Blocklist.ReloadInterval,
+		AdminToken:              c.Admin.Token,
+		ShortenLimit:            internal.RateLimit{Limit: c.RateLimit.ShortenLimit, Window: c.RateLimit.ShortenWindow},
+		RedirectLimit:           internal.RateLimit{Limit: c.RateLimit.RedirectLimit, Window: c.RateLimit.RedirectWindow},
+		APIKeys:                 make(map[string]bool, len(c.RateLimit.APIKeys)),
+		CookieSecret:            []byte(c.Passwords.CookieSecret),
+		SecureCookies:           strings.HasPrefix(c.App.Domain, "https://"),
+		UnlockTTL:               c.Passwords.UnlockTTL,
+		UnlockLimit:             internal.RateLimit{Limit: c.Passwords.MaxAttempts, Window: c.Passwords.AttemptWindow},
+		RedisBreaker:            internal.NewCircuitBreaker(c.Cache.BreakerFailures, c.Cache.BreakerCooldown, onRedisBreakerChange),
+	}
+	for _, scheme := range c.Links.AllowedSchemes {
+		cfg.URLs.AllowedSchemes = append(cfg.URLs.AllowedSchemes, strings.ToLower(scheme))
+	}
+	if len(cfg.CookieSecret) == 0 {
+		slog.Warn("LINK_COOKIE_SECRET not set, unlocked protected links lock again on restart and across replicas")
+		cfg.CookieSecret = make([]byte, 32)
+		if _, err := rand.Read(cfg.CookieSecret); err != nil {
+			return nil, fmt.Errorf("failed to generate cookie secret: %w", err)
+		}
+	}
+	for _, key := range c.RateLimit.APIKeys {
+		cfg.APIKeys[key] = true
+	}
+	for _, domain := range c.Links.Shorteners {
+		cfg.Shorteners[strings.TrimSuffix(strings.ToLower(domain), ".")] = true
+	}
+	if c.Cache.BloomEnabled {
+		cfg.BloomRebuildInterval = c.Cache.BloomRebuildInterval
+	}
+	return cfg, nil
+}
+
+// Start runs the background jobs keeping cfg's caches in shape until ctx is
+// done.
+func Start(ctx context.Context, cfg *Config) {
+	go subscribeInvalidations(ctx, cfg)
+	go runBlocklistReloads(ctx, cfg, cfg.BlocklistReloadInterval)
+	if cfg.BloomRebuildInterval > 0 {
+		go cfg.Codes.runRebuilds(ctx, cfg.Links, cfg.BloomRebuildInterval)
+	}
+	if cfg.CacheWarmTopN > 0 {
+		go runCacheWarmer(ctx, cfg, cfg.CacheWarmTopN, cfg.CacheWarmInterval)
+	}
+}
+
+func NewApp(cfg *Config) *fiber.App {
+	app := fiber.New(fiber.Config{
+		ReadTimeout:  cfg.HTTP.ReadTimeout,
+		WriteTimeout: cfg.HTTP.WriteTimeout,
+		IdleTimeout:  cfg.HTTP.IdleTimeout,
+		BodyLimit:    cfg.HTTP.BodyLimit,
+		// Rate limits key on the client IP, which a load balancer hides.
+		// The header only counts from trusted proxies, and only when it
+		// holds an IP: anything else falls back to the peer address.
+		ProxyHeader:             cfg.HTTP.ProxyHeader,
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          cfg.HTTP.TrustedProxies,
+		EnableIPValidation:      true,
+	})
+
+	// Registered ahead of the middlewares so probes don't flood logs,
+	// metrics and traces, and ahead of /:short_code which would capture them.
+	checker := health.NewChecker()
+	checker.Add("storage", cfg.Links.Ping)
+	checker.AddOptional("cache", cfg.Cache.Ping)
+	checker.Add("events", cfg.Events.Ping)
+	if cfg.IDServiceHealthURL != "" {
+		checker.Add("id-service", health.HTTP(cfg.IDServiceHealthURL))
+	}
+	checker.Register(app)
+
+	app.Use(applog.FiberMiddleware())
+	app.Use(metrics.FiberMiddleware())
+	app.Use(tracing.FiberMiddleware())
+	app.Use(cors.New())
+
+	// Must be registered before /:short_code, which would capture it
+	app.Get("/metrics", metrics.Handler())
+	registerAdmin(app, cfg)
+	app.Get("/:short_code", rateLimit(cfg, "redirect", cfg.RedirectLimit), handleRedirect(cfg))
+	app.Post("/shorten", rateLimit(cfg, "shorten", cfg.ShortenLimit), handleShorten(cfg))
+	// After /shorten, which it would capture
+	app.Post("/:short_code", handleUnlock(cfg))
+	app.Get("/stats/utm/:dimension", handleGetUTMStats(cfg))
+	app.Get("/stats/:short_code", handleGetStats(cfg))
+
+	return app
+}
+
+func handleRedirect(cfg *Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		// Base58 codes never contain "+", which asks for the preview page
+		// Cloned: fiber reuses the request buffer the param points into,
+		// and the code ends up as a cache and singleflight key.
+		shortCode, preview := strings.CutSuffix(strings.Clone(c.Params("short_code")), "+")
+		preview = preview || c.QueryBool("preview")
+		reqID := c.Locals("request_id").(string)
+		ctx := applog.WithRequestID(c.UserContext(), reqID)
+
+		if !cfg.Codes.MayExist(shortCode) {
+			bloomRejections.Inc()
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Short URL not found"})
+		}
+
+		link, err := resolveLink(ctx, cfg, shortCode)
+		if errors.Is(err, errLinkNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Short URL not found"})
+		} else if err != nil {
+			slog.Error("DB error", "err", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+		}
+		// Checked on every redirect, so links created before their domain
+		// was blocked stop working as soon as the blocklist reloads.
+		if pattern, blocked := cfg.Blocklist.MatchURL(link.LongURL); blocked {
+			blocklistRejections.WithLabelValues("redirect").Inc()
+			slog.Warn("Redirect to blocked destination refused", "short_code", shortCode, "pattern", pattern, "request_id", reqID)
+			return renderBlocked(c, shortCode, hostOf(link.LongURL))
+		}
+		revealed := !link.Protected || unlocked(cfg, c, shortCode)
+		// UTM is applied here rather than stored in the destination, so
+		// editing it takes effect on the next redirect
+		destination := internal.MergeQuery(link.UTM.Apply(link.LongURL), string(c.Request().URI().QueryString()), link.QueryMode, "preview")
+		if preview {
+			if !revealed {
+				destination = ""
+			}
+			return renderPreview(ctx, c, cfg, shortCode, link, destination, link.Interstitial)
+		}
+		// No click either until the password is entered
+		if !revealed {
+			return renderPasswordForm(c, fiber.StatusOK, shortCode, "")
+		}
+
+		userAgent := c.Get("User-Agent")
+		if userAgent == "" {
+			userAgent = "Unknown"
+		}
+		// Fiber reuses request buffers once the handler returns, so copy
+		// everything handed over to the publishing goroutine.
+		event := internal.ClickEvent{
+			ShortCode: strings.Clone(shortCode),
+			UserAgent: strings.Clone(userAgent),
+			Method:    strings.Clone(c.Method()),
+			Accept:    strings.Clone(c.Get("Accept")),
+			Purpose:   strings.Clone(clickPurpose(c)),
+			RequestID: strings.Clone(reqID),
+		}
+		go publishClickEvent(ctx, cfg, event, strings.Clone(c.IP()))
+
+		// The visitor followed the short link either way, so the interstitial
+		// counts as a click; its continue link goes straight to the target.
+		if link.Interstitial {
+			return renderPreview(ctx, c, cfg, shortCode, link, destination, true)
+		}
+		status := link.RedirectStatus
+		if status == 0 {
+			status = fiber.StatusFound
+		}
+		return c.Redirect(destination, status)
+	}
+}
+
+func handleShorten(cfg *Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req struct {
+			URL string `json:"url"`
+			// Optional; protected links are never shared with other requests
+			Password string `json:"password"`
+			// Always show the preview page before redirecting
+			Interstitial   bool               `json:"interstitial"`
+			RedirectStatus int                `json:"redirect_status"`
+			QueryMode      internal.QueryMode `json:"query_mode"`
+			// Added to the destination's query string on redirect
+			UTM internal.UTM `json:"utm"`
+		}
+		// Temporary by default: permanent redirects (301, 308) are cached by
+		// browsers, whose later clicks never reach us
+		req.RedirectStatus = fiber.StatusFound
+		req.QueryMode = internal.QueryDrop
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+		}
+		if req.URL == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "URL cannot be empty"})
+		}
+		if !redirectStatuses[req.RedirectStatus] {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "redirect_status must be one of 301, 302, 307, 308"})
+		}
+		if !req.QueryMode.Valid() {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "query_mode must be one of drop, merge, override"})
+		}
+		utm, err := req.UTM.Normalize()
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		// Stored normalized, so equivalent spellings dedup to the same link
+		longURL, err := cfg.URLs.Normalize(req.URL)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		reqID, _ := c.Locals("request_id").(string)
+		ctx := applog.WithRequestID(c.UserContext(), reqID)
+
+		// Chained short links would dodge the blocklist and could loop
+		longURL, flagged, err := unwrapDestination(ctx, cfg, longURL)
+		if errors.Is(err, internal.ErrInvalidURL) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		} else if err != nil {
+			slog.Error("DB error", "err", err, "request_id", reqID)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+		}
+
+		if pattern, blocked := cfg.Blocklist.MatchURL(longURL); blocked {
+			blocklistRejections.WithLabelValues("shorten").Inc()
+			slog.Warn("Shortening blocked destination refused", "pattern", pattern, "request_id", reqID)
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Destination domain is blocked"})
+		}
+
+		// Wrapping a flagged link must not skip its interstitial
+		newURL := internal.URL{
+			LongURL:        longURL,
+			Interstitial:   req.Interstitial || flagged,
+			RedirectStatus: req.RedirectStatus,
+			QueryMode:      req.QueryMode,
+			UTM:            utm,
+		}
+		if req.Password != "" {
+			if newURL.PasswordHash, err = hashPassword(req.Password); errors.Is(err, errPasswordLength) {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+			} else if err != nil {
+				slog.Error("Error hashing password", "err", err, "request_id", reqID)
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not save URL"})
+			}
+		} else if existingURL, err := cfg.Links.FindDuplicate(ctx, newURL); err == nil {
+			return c.JSON(fiber.Map{
+				"short_url": fmt.Sprintf("%s/%s", cfg.AppDomain, existingURL.ShortCode),
+			})
+		}
+
+		id, err := cfg.NewID(ctx)
+		if err != nil {
+			slog.Error("Error getting new ID", "err", err, "request_id", reqID)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not generate ID"})
+		}
+
+		shortCode := internal.EncodeID(id)
+		newURL.ID = int64(id) // TODO: improve this id type. at this time, tmp cast this value
+		newURL.ShortCode = shortCode
+
+		if err := cfg.Links.Create(ctx, &newURL); err != nil {
+			slog.Error("Error creating short URL", "err", err, "request_id", reqID)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not save URL"})
+		}
+
+		cfg.Codes.Add(shortCode)
+		// A scanner may have probed this code before it existed
+		if err := invalidateLink(ctx, cfg, shortCode); err != nil {
+			slog.Error("Error invalidating negative cache", "err", err, "request_id", reqID)
+		}
+
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+			"short_url": fmt.Sprintf("%s/%s", cfg.AppDomain, shortCode),
+		})
+	}
+}
+
+func handleGetStats(cfg *Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		shortCode := c.Params("short_code")
+		reqID, _ := c.Locals("request_id").(string)
+		ctx := applog.WithRequestID(c.UserContext(), reqID)
+
+		days := c.QueryInt("days", defaultStatsDays)
+		if days < 1 || days > maxStatsDays {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("days must be between 1 and %d", maxStatsDays)})
+		}
+
+		var classes []internal.TrafficClass
+		traffic := c.Query("traffic", "human")
+		switch traffic {
+		case "human":
+			classes = []internal.TrafficClass{internal.TrafficHuman}
+		case "bot":
+			classes = []internal.TrafficClass{internal.TrafficBot}
+		case "all":
+			classes = []internal.TrafficClass{internal.TrafficHuman, internal.TrafficBot}
+		default:
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "traffic must be one of human, bot, all"})
+		}
+
+		link, err := cfg.Links.FindByCode(ctx, shortCode)
+		if errors.Is(err, internal.ErrLinkNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Short URL not found"})
+		} else if err != nil {
+			slog.Error("DB error", "err", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+		}
+
+		// The cache only holds the near-real-time parts of the stats; without
+		// it we still answer with what storage has and flag the response.
+		analytics, degraded, err := currentClicks(ctx, cfg, shortCode)
+		if err != nil {
+			slog.Error("DB error", "err", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+		}
+
+		now := time.Now()
+		groups := make([][]string, 0, days)
+		for i := 0; i < days; i++ {
+			day := internal.VisitorDay(now.AddDate(0, 0, -i))
+			dayKeys := make([]string, 0, len(classes))
+			for _, class := range classes {
+				dayKeys = append(dayKeys, internal.UniqueVisitorsKey(shortCode, class, day))
+			}
+			groups = append(groups, dayKeys)
+		}
+		// Visitor hashes are salted per day, so nobody can be recognized
+		// across days: the window figure is the sum of daily uniques and
+		// counts a visitor once for every day they were seen.
+		var uniqueVisitorsSum any
+		var daily []fiber.Map
+		if counts, err := cfg.Stats.UniqueCounts(ctx, groups...); err != nil {
+			slog.Warn("Unique visitors unavailable", "err", err)
+			degraded = true
+		} else {
+			var sum int64
+			daily = make([]fiber.Map, 0, days)
+			for i, count := range counts {
+				sum += count
+				daily = append(daily, fiber.Map{
+					"date":            now.AddDate(0, 0, -i).UTC().Format(time.DateOnly),
+					"unique_visitors": count,
+				})
+			}
+			uniqueVisitorsSum = sum
+		}
+
+		clicks := analytics.ClickCount
+		switch traffic {
+		case "human":
+			clicks = analytics.HumanClickCount
+		case "bot":
+			clicks = analytics.BotClickCount
+		}
+
+		return c.JSON(fiber.Map{
+			"short_code": shortCode,
+			"traffic":    traffic,
+			"utm":        link.UTM,
+			"clicks":     clicks,
+			"clicks_by_traffic": fiber.Map{
+				"human": analytics.HumanClickCount,
+				"bot":   analytics.BotClickCount,
+			},
+			"days":                      days,
+			"unique_visitors_daily_sum": uniqueVisitorsSum,
+			"daily":                     daily,
+			"degraded":                  degraded,
+		})
+	}
+}
+
+// currentClicks returns the persisted click counts of shortCode plus the
+// deltas buffered by the worker's Redis aggregation, which aren't in
+// url_analytics yet. degraded is set when only persisted counts are known.
+func currentClicks(ctx context.Context, cfg *Config, shortCode string) (internal.URLAnalytics, bool, error) {
+	degraded := false
+	pending, err := cfg.Stats.PendingClicks(ctx, shortCode)
+	if err != nil {
+		slog.Warn("Pending clicks unavailable", "err", err)
+		degraded = true
+	}
+	// Read after the cache: a flush committing meanwhile is reported as
+	// applied, and its snapshot isn't counted twice.
+	analytics, applied, err := cfg.Links.Analytics(ctx, shortCode, pending.Batch)
+	if err != nil {
+		return internal.URLAnalytics{}, degraded, err
+	}
+	deltas := []internal.URLAnalytics{pending.Pending}
+	if !applied {
+		deltas = append(deltas, pending.Flushing)
+	}
+	for _, d := range deltas {
+		analytics.ClickCount += d.ClickCount
+		analytics.HumanClickCount += d.HumanClickCount
+		analytics.BotClickCount += d.BotClickCount
+	}
+	return analytics, degraded, nil
+}
+
+// handleGetUTMStats reports the persisted clicks of links grouped by one
+// UTM dimension, optionally narrowed down by the others, e.g.
+// /stats/utm/source?campaign=spring.
+func handleGetUTMStats(cfg *Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		dimension := c.Params("dimension")
+		if _, ok := internal.UTMDimensions[dimension]; !ok {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "dimension must be one of source, medium, campaign, term, content"})
+		}
+		limit := c.QueryInt("limit", defaultUTMStatsLimit)
+		if limit < 1 || limit > maxUTMStatsLimit {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("limit must be between 1 and %d", maxUTMStatsLimit)})
+		}
+		filter, err := internal.UTM{
+			Source:   c.Query("source"),
+			Medium:   c.Query("medium"),
+			Campaign: c.Query("campaign"),
+			Term:     c.Query("term"),
+			Content:  c.Query("content"),
+		}.Normalize()
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		reqID, _ := c.Locals("request_id").(string)
+		ctx := applog.WithRequestID(c.UserContext(), reqID)
+
+		// Only persisted counts: clicks still buffered by the worker are
+		// tracked per link, not per UTM value.
+		rows, err := cfg.Links.ClicksByUTM(ctx, dimension, filter, limit)
+		if err != nil {
+			slog.Error("DB error", "err", err, "request_id", reqID)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+		}
+		return c.JSON(fiber.Map{
+			"dimension": dimension,
+			"filter":    filter,
+			"values":    rows,
+		})
+	}
+}
+
+func clickPurpose(c *fiber.Ctx) string {
+	for _, h := range purposeHeaders {
+		if v := c.Get(h); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func publishClickEvent(ctx context.Context, cfg *Config, event internal.ClickEvent, ip string) {
+	event.Timestamp = time.Now()
+	// The daily salt lives in the cache. Without it the click still counts,
+	// it just won't contribute to unique visitors.
+	if cfg.RedisBreaker.Allow() {
+		visitorID, err := cfg.Visitors.Hash(ctx, event.Timestamp, ip, event.UserAgent)
+		recordRedisResult(cfg, err)
+		if err != nil {
+			slog.Error("Error hashing visitor", "err", err)
+		}
+		event.VisitorID = visitorID
+	}
+	slog.Info("Publishing click event", "event", event)
+
+	if err := cfg.Events.PublishClick(ctx, event); err != nil {
+		slog.Error("Error publishing click event", "err", err)
+	}
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"context"
+	"html/template"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Replicas publish here after changing the stored blocklist, so every
+// replica reloads it right away instead of at its next periodic reload.
+const blocklistChannel = "blocklist:reload"
+
+var blockedPage = template.Must(template.New("blocked").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Link disabled</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 36rem; margin: 4rem auto; padding: 0 1rem; color: #222; }
+h1 { color: #b00020; }
+code { background: #f3f3f3; padding: 0 .25rem; }
+</style>
+</head>
+<body>
+<h1>This link has been disabled</h1>
+<p>The short link <code>{{.ShortCode}}</code> points to <code>{{.Host}}</code>, a domain that has been blocked for
+phishing, malware or other abuse. You have not been redirected.</p>
+<p>If you believe this is a mistake, contact the operators of this service.</p>
+</body>
+</html>
+`))
+
+// renderBlocked answers a redirect to a blocked destination with 451 and an
+// explanation page in place of the redirect.
+func renderBlocked(c *fiber.Ctx, shortCode, host string) error {
+	c.Status(fiber.StatusUnavailableForLegalReasons)
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return blockedPage.Execute(c.Response().BodyWriter(), struct{ ShortCode, Host string }{shortCode, host})
+}
+
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// reloadBlocklist reloads cfg's blocklist, logging failures: the current
+// list stays in place until a reload succeeds.
+func reloadBlocklist(ctx context.Context, cfg *Config) {
+	if err := cfg.Blocklist.Reload(ctx); err != nil {
+		slog.Error("Failed to reload blocklist", "err", err)
+	}
+}
+
+// notifyBlocklistChanged reloads the local blocklist and asks the other
+// replicas to do the same. Those missing the message catch up at their next
+// periodic reload.
+func notifyBlocklistChanged(ctx context.Context, cfg *Config) {
+	reloadBlocklist(ctx, cfg)
+	if !cfg.RedisBreaker.Allow() {
+		return
+	}
+	err := cfg.Cache.Publish(ctx, blocklistChannel, "")
+	recordRedisResult(cfg, err)
+	if err != nil {
+		slog.Warn("Failed to announce blocklist change", "err", err)
+	}
+}
+
+// runBlocklistReloads reloads the blocklist every interval, picking up file
+// edits, and whenever another replica announces a change.
+func runBlocklistReloads(ctx context.Context, cfg *Config, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	changes := cfg.Cache.Subscribe(ctx, blocklistChannel)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloadBlocklist(ctx, cfg)
+		case _, ok := <-changes:
+			if !ok {
+				slog.Warn("Blocklist change subscription closed")
+				// Periodic reloads only from now on
+				changes = nil
+				continue
+			}
+			reloadBlocklist(ctx, cfg)
+		}
+	}
+}
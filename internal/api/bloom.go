@@ -0,0 +1,135 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/bits-and-blooms/bloom/v3"
+
+	"github.com/MagnunAVF/url-shortener/internal"
+	"github.com/MagnunAVF/url-shortener/internal/idgen"
+)
+
+const (
+	// Room for links created until the next rebuild
+	bloomHeadroom   = 2
+	bloomMinEntries = 100000
+	bloomScanBatch  = 10000
+	// Allowed difference between the clocks of the ID generator and this
+	// replica, see MayExist
+	bloomClockSkew = time.Minute
+)
+
+// codeFilter is a Bloom filter of every existing short code, letting
+// redirects reject codes that can't exist without touching storage. Other
+// replicas' new codes arrive through the invalidation channel, and a
+// periodic rebuild from storage resizes the filter as the table grows.
+type codeFilter struct {
+	fpRate float64
+
+	mu     sync.RWMutex
+	filter *bloom.BloomFilter
+	// When the scan loading filter started
+	builtAt time.Time
+	// Codes added while a rebuild scans the table, replayed before the swap
+	pending    []string
+	rebuilding bool
+}
+
+func newCodeFilter(fpRate float64) *codeFilter {
+	return &codeFilter{fpRate: fpRate}
+}
+
+// MayExist is false only when shortCode definitely doesn't exist. Until the
+// first build completes every code may exist, and so do codes whose ID was
+// generated after the last rebuild started: another replica may have
+// created them while its invalidation message, which adds them here, was
+// lost or couldn't be sent with Redis down.
+func (f *codeFilter) MayExist(shortCode string) bool {
+	f.mu.RLock()
+	filter, builtAt := f.filter, f.builtAt
+	f.mu.RUnlock()
+	if filter == nil || filter.TestString(shortCode) {
+		return true
+	}
+	id, ok := internal.DecodeID(shortCode)
+	if !ok {
+		return false
+	}
+	// Bounded in the future too, so made-up codes can't all get through
+	created := idgen.Time(id)
+	return created.After(builtAt.Add(-bloomClockSkew)) && created.Before(time.Now().Add(bloomClockSkew))
+}
+
+func (f *codeFilter) Add(shortCode string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.filter != nil {
+		f.filter.AddString(shortCode)
+	}
+	if f.rebuilding {
+		f.pending = append(f.pending, shortCode)
+	}
+}
+
+// Rebuild loads every short code from links into a fresh filter and swaps it
+// in.
+func (f *codeFilter) Rebuild(ctx context.Context, links internal.LinkStore) error {
+	start := time.Now()
+	f.mu.Lock()
+	f.rebuilding = true
+	f.pending = nil
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.rebuilding = false
+		f.pending = nil
+		f.mu.Unlock()
+	}()
+
+	count, err := links.Count(ctx)
+	if err != nil {
+		return err
+	}
+	n := uint(count) * bloomHeadroom
+	if n < bloomMinEntries {
+		n = bloomMinEntries
+	}
+	filter := bloom.NewWithEstimates(n, f.fpRate)
+
+	err = links.ScanShortCodes(ctx, bloomScanBatch, func(codes []string) {
+		for _, code := range codes {
+			filter.AddString(code)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	for _, code := range f.pending {
+		filter.AddString(code)
+	}
+	f.filter = filter
+	f.builtAt = start
+	f.mu.Unlock()
+
+	slog.Info("Rebuilt short code Bloom filter", "codes", count, "capacity", n)
+	return nil
+}
+
+// runRebuilds builds the filter right away, then every interval.
+func (f *codeFilter) runRebuilds(ctx context.Context, links internal.LinkStore, interval time.Duration) {
+	for {
+		if err := f.Rebuild(ctx, links); err != nil {
+			slog.Error("Failed to rebuild short code Bloom filter", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"context"
+	"testing"
+
+	"github.com/MagnunAVF/url-shortener/internal"
+	"github.com/MagnunAVF/url-shortener/internal/idgen"
+)
+
+func TestCodeFilterMayExist(t *testing.T) {
+	gen, err := idgen.New(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newCode := func() string {
+		id, err := gen.NextID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return internal.EncodeID(id)
+	}
+
+	links := internal.NewMemoryLinkStore()
+	stored := newCode()
+	if err := links.Create(context.Background(), &internal.URL{ShortCode: stored, LongURL: "https://example.com/"}); err != nil {
+		t.Fatal(err)
+	}
+	f := newCodeFilter(0.001)
+	if !f.MayExist("anything") {
+		t.Fatal("codes must pass before the first build")
+	}
+	if err := f.Rebuild(context.Background(), links); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		code string
+		want bool
+	}{
+		{"stored", stored, true},
+		// Created elsewhere after the rebuild, without the filter hearing of it
+		{"newer than the filter", newCode(), true},
+		{"older than the filter", internal.EncodeID(1 << 40), false},
+		{"far future", internal.EncodeID(^uint64(0)), false},
+		{"not base58", "0OIl", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := f.MayExist(tt.code); got != tt.want {
+				t.Errorf("MayExist(%s) = %v, want %v", tt.code, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+
+	"github.com/MagnunAVF/url-shortener/internal"
+)
+
+// Replicas publish short codes here when a link changes, so every replica
+// drops its local copy.
+const invalidationChannel = "url:invalidate"
+
+// newLocalCache builds the in-process cache. Its TTL bounds staleness should
+// an invalidation message get lost while the subscription reconnects.
+func newLocalCache(size int, ttl time.Duration) *expirable.LRU[string, cachedLink] {
+	return expirable.NewLRU[string, cachedLink](size, nil, ttl)
+}
+
+// invalidateLink drops shortCode from the shared cache and from the local
+// cache of every replica. Call it whenever a link is created, updated or
+// deleted.
+func invalidateLink(ctx context.Context, cfg *Config, shortCode string) error {
+	cfg.LocalCache.Remove(shortCode)
+	if !cfg.RedisBreaker.Allow() {
+		// Other replicas catch up when their local entries expire
+		return errBreakerOpen
+	}
+	err := cfg.Cache.Delete(ctx, cacheKeyPrefix+shortCode)
+	if err == nil {
+		err = cfg.Cache.Publish(ctx, invalidationChannel, shortCode)
+	}
+	recordRedisResult(cfg, err)
+	return err
+}
+
+// refreshLink is invalidateLink for a link just updated: it caches link, as
+// read from the primary, instead of only dropping the cached copy. A
+// redirect right after the update would otherwise reload the link from a
+// replica that may not have the update yet, and cache that for hours.
+func refreshLink(ctx context.Context, cfg *Config, link internal.LinkClicks) error {
+	cached := newCachedLink(link)
+	cfg.LocalCache.Add(link.ShortCode, cached)
+	if !cfg.RedisBreaker.Allow() {
+		return errBreakerOpen
+	}
+	err := cfg.Cache.Set(ctx, cacheKeyPrefix+link.ShortCode, cached.encode(), popularityTTL(link.ClickCount))
+	if err == nil {
+		err = cfg.Cache.Publish(ctx, invalidationChannel, link.ShortCode)
+	}
+	recordRedisResult(cfg, err)
+	return err
+}
+
+// subscribeInvalidations evicts local entries as invalidations arrive and
+// makes the codes known to the Bloom filter.
+func subscribeInvalidations(ctx context.Context, cfg *Config) {
+	for shortCode := range cfg.Cache.Subscribe(ctx, invalidationChannel) {
+		cfg.LocalCache.Remove(shortCode)
+		// The link may have just been created on another replica
+		cfg.Codes.Add(shortCode)
+	}
+	slog.Warn("Cache invalidation subscription closed")
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	bloomRejections = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "redirect_bloom_rejections_total",
+		Help: "Redirects answered 404 by the Bloom filter without any storage access.",
+	})
+
+	localCacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "redirect_local_cache_lookups_total",
+		Help: "In-process cache lookups done by redirects, by result (hit, miss).",
+	}, []string{"result"})
+
+	cacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "redirect_cache_lookups_total",
+		Help: "Redis lookups done by redirects, by result (hit, negative_hit, miss, skipped, error).",
+	}, []string{"result"})
+
+	redisDegraded = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "redirect_redis_degraded_total",
+		Help: "Redirects served from the database because Redis was unusable, by reason (error, breaker_open).",
+	}, []string{"reason"})
+
+	blocklistRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "blocklist_rejections_total",
+		Help: "Requests refused because the destination is blocklisted, by action (shorten, redirect).",
+	}, []string{"action"})
+
+	rateLimitDecisions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rate_limit_decisions_total",
+		Help: "Rate limiter decisions, by scope (shorten, redirect) and result (allowed, limited, skipped, error).",
+	}, []string{"scope", "result"})
+
+	unlockAttempts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "link_unlock_attempts_total",
+		Help: "Password attempts on protected links, by result (unlocked, wrong_password, limited).",
+	}, []string{"result"})
+
+	redisBreakerState = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "redis_circuit_breaker_state",
+		Help: "State of the Redis circuit breaker: 0 closed, 1 open, 2 half-open.",
+	})
+)
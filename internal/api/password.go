@@ -0,0 +1,183 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/MagnunAVF/url-shortener/internal"
+	applog "github.com/MagnunAVF/url-shortener/internal/logger"
+)
+
+const (
+	unlockCookiePrefix = "unlock_"
+	minPasswordLength  = 4
+	// bcrypt ignores anything longer
+	maxPasswordBytes = 72
+	// Attempts on one link from every client together, as a multiple of the
+	// per-client limit: slows distributed guessing without letting a single
+	// client lock legitimate users out.
+	linkAttemptsFactor = 10
+)
+
+var errPasswordLength = errors.New("password must be between 4 and 72 bytes long")
+
+var passwordPage = template.Must(template.New("password").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Password required</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 24rem; margin: 4rem auto; padding: 0 1rem; color: #222; }
+input, button { font-size: 1rem; padding: .5rem; }
+.error { color: #b00020; }
+</style>
+</head>
+<body>
+<h1>Password required</h1>
+<p>This link is password protected.</p>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<form method="post" action="/{{.ShortCode}}">
+<input type="password" name="password" aria-label="Password" autocomplete="current-password" required autofocus>
+<button type="submit">Continue</button>
+</form>
+</body>
+</html>
+`))
+
+// hashPassword validates password and returns its bcrypt hash.
+func hashPassword(password string) (string, error) {
+	if len(password) < minPasswordLength || len(password) > maxPasswordBytes {
+		return "", errPasswordLength
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+func renderPasswordForm(c *fiber.Ctx, status int, shortCode, message string) error {
+	c.Status(status)
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Set(fiber.HeaderXFrameOptions, "DENY")
+	return passwordPage.Execute(c.Response().BodyWriter(), struct{ ShortCode, Error string }{shortCode, message})
+}
+
+// unlockToken signs shortCode and the expiry of the cookie carrying it.
+func unlockToken(cfg *Config, shortCode string, expires int64) string {
+	mac := hmac.New(sha256.New, cfg.CookieSecret)
+	mac.Write([]byte(shortCode + "|" + strconv.FormatInt(expires, 10)))
+	return strconv.FormatInt(expires, 10) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// unlocked reports whether the request carries an unexpired unlock cookie
+// for shortCode.
+func unlocked(cfg *Config, c *fiber.Ctx, shortCode string) bool {
+	token := c.Cookies(unlockCookiePrefix + shortCode)
+	exp, _, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	expires, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || time.Now().Unix() >= expires {
+		return false
+	}
+	return hmac.Equal([]byte(token), []byte(unlockToken(cfg, shortCode, expires)))
+}
+
+// handleUnlock checks the password form of a protected link. On success it
+// sets the unlock cookie and sends the client back to the short URL, where
+// the redirect (and its click) happens as usual.
+func handleUnlock(cfg *Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		// Cloned like in handleRedirect, fiber reuses the request buffer
+		shortCode := strings.Clone(c.Params("short_code"))
+		reqID, _ := c.Locals("request_id").(string)
+		ctx := applog.WithRequestID(c.UserContext(), reqID)
+
+		if !cfg.Codes.MayExist(shortCode) {
+			bloomRejections.Inc()
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Short URL not found"})
+		}
+
+		if wait, ok := allowUnlockAttempt(cfg, c, shortCode); !ok {
+			unlockAttempts.WithLabelValues("limited").Inc()
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			return renderPasswordForm(c, fiber.StatusTooManyRequests, shortCode, "Too many attempts, try again later.")
+		}
+
+		// The hash is never cached, so this always goes to storage
+		link, err := cfg.Links.FindByCode(ctx, shortCode)
+		if errors.Is(err, internal.ErrLinkNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Short URL not found"})
+		} else if err != nil {
+			slog.Error("DB error", "err", err, "request_id", reqID)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+		}
+		if link.PasswordHash == "" {
+			return c.Redirect("/"+shortCode, fiber.StatusSeeOther)
+		}
+
+		err = bcrypt.CompareHashAndPassword([]byte(link.PasswordHash), []byte(c.FormValue("password")))
+		if err != nil {
+			unlockAttempts.WithLabelValues("wrong_password").Inc()
+			return renderPasswordForm(c, fiber.StatusUnauthorized, shortCode, "Wrong password.")
+		}
+		unlockAttempts.WithLabelValues("unlocked").Inc()
+
+		expires := time.Now().Add(cfg.UnlockTTL)
+		// Scoped by name rather than path: a cookie on /<code> wouldn't
+		// reach the preview at /<code>+.
+		c.Cookie(&fiber.Cookie{
+			Name:     unlockCookiePrefix + shortCode,
+			Value:    unlockToken(cfg, shortCode, expires.Unix()),
+			Path:     "/",
+			Expires:  expires,
+			Secure:   cfg.SecureCookies,
+			HTTPOnly: true,
+			SameSite: fiber.CookieSameSiteLaxMode,
+		})
+		return c.Redirect("/"+shortCode, fiber.StatusSeeOther)
+	}
+}
+
+// allowUnlockAttempt counts an attempt against the per-client and per-link
+// limits, returning how long to wait when either is exhausted. Like other
+// rate limits it lets attempts through when the limiter is unusable; the
+// bcrypt cost still bounds the guessing rate then.
+func allowUnlockAttempt(cfg *Config, c *fiber.Ctx, shortCode string) (time.Duration, bool) {
+	if cfg.Limiter == nil || cfg.UnlockLimit.Limit == 0 || !cfg.RedisBreaker.Allow() {
+		return 0, true
+	}
+	linkLimit := internal.RateLimit{Limit: cfg.UnlockLimit.Limit * linkAttemptsFactor, Window: cfg.UnlockLimit.Window}
+	checks := []struct {
+		key   string
+		limit internal.RateLimit
+	}{
+		{"unlock:" + shortCode + ":" + clientKey(cfg, c), cfg.UnlockLimit},
+		{"unlock:" + shortCode, linkLimit},
+	}
+	for _, check := range checks {
+		res, err := cfg.Limiter.Allow(c.UserContext(), check.key, check.limit)
+		recordRedisResult(cfg, err)
+		if err != nil {
+			slog.Warn("Rate limiter unavailable, letting unlock attempt through", "err", err)
+			return 0, true
+		}
+		if !res.Allowed {
+			return res.Reset, false
+		}
+	}
+	return 0, true
+}
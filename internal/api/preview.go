@@ -0,0 +1,85 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/MagnunAVF/url-shortener/internal"
+)
+
+var previewPage = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Link preview</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 36rem; margin: 4rem auto; padding: 0 1rem; color: #222; }
+dt { font-weight: bold; margin-top: .75rem; }
+dd { margin: 0; overflow-wrap: anywhere; }
+.warning { background: #fff4e5; border-left: 4px solid #e65100; padding: .5rem 1rem; }
+.continue { display: inline-block; margin-top: 1.5rem; }
+</style>
+</head>
+<body>
+<h1>Link preview</h1>
+{{if .Flagged}}<p class="warning">This link has been flagged as potentially risky. Make sure you trust the destination before continuing.</p>{{end}}
+<dl>
+<dt>Short link</dt><dd>{{.ShortURL}}</dd>
+<dt>Destination</dt><dd>{{if .Destination}}{{.Destination}}{{else}}Hidden, this link is password protected{{end}}</dd>
+<dt>Created</dt><dd>{{.Created}}</dd>
+<dt>Clicks</dt><dd>{{.Clicks}}</dd>
+</dl>
+{{if .Destination}}<a class="continue" href="{{.Destination}}" rel="noreferrer">Continue to {{.Host}}</a>{{end}}
+</body>
+</html>
+`))
+
+// renderPreview shows where shortCode leads instead of redirecting. An empty
+// destination stays hidden, as for protected links not unlocked yet.
+// flagged adds the warning of interstitial links.
+//
+// Interstitial links render it on every redirect, so it sticks to the cached
+// link: the click count is the one the link was cached with, up to the
+// cache TTL behind /stats.
+func renderPreview(ctx context.Context, c *fiber.Ctx, cfg *Config, shortCode string, link cachedLink, destination string, flagged bool) error {
+	if link.CreatedAt.IsZero() {
+		stored, err := cfg.Links.FindByCode(ctx, shortCode)
+		if errors.Is(err, internal.ErrLinkNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Short URL not found"})
+		} else if err != nil {
+			slog.Error("DB error", "err", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+		}
+		link.CreatedAt, link.ClickCount = stored.CreatedAt, stored.ClickCount
+	}
+
+	data := struct {
+		ShortURL, Host, Created string
+		Destination             template.URL
+		Clicks                  int64
+		Flagged                 bool
+	}{
+		ShortURL: cfg.AppDomain + "/" + shortCode,
+		Created:  link.CreatedAt.UTC().Format(time.RFC1123),
+		Clicks:   link.ClickCount,
+		Flagged:  flagged,
+	}
+	if destination != "" {
+		// Stored destinations passed URLPolicy.Normalize, so the scheme is
+		// one the policy allows. html/template would otherwise replace deep
+		// links, whose schemes it doesn't know, with "#ZgotmplZ".
+		data.Destination = template.URL(destination)
+		data.Host = hostOf(destination)
+	}
+
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return previewPage.Execute(c.Response().BodyWriter(), data)
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"math"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/MagnunAVF/url-shortener/internal"
+)
+
+const apiKeyHeader = "X-API-Key"
+
+// rateLimit enforces limit per client on the routes it guards, answering
+// 429 once exhausted. Every response carries the RateLimit-* headers of the
+// IETF draft. The limiter lives in Redis, so when Redis is unusable requests
+// go through unlimited rather than failing.
+func rateLimit(cfg *Config, scope string, limit internal.RateLimit) fiber.Handler {
+	policy := strconv.Itoa(limit.Limit) + ";w=" + strconv.Itoa(int(limit.Window.Seconds()))
+	return func(c *fiber.Ctx) error {
+		if limit.Limit == 0 || cfg.Limiter == nil {
+			return c.Next()
+		}
+		if !cfg.RedisBreaker.Allow() {
+			rateLimitDecisions.WithLabelValues(scope, "skipped").Inc()
+			return c.Next()
+		}
+
+		res, err := cfg.Limiter.Allow(c.UserContext(), scope+":"+clientKey(cfg, c), limit)
+		recordRedisResult(cfg, err)
+		if err != nil {
+			rateLimitDecisions.WithLabelValues(scope, "error").Inc()
+			slog.Warn("Rate limiter unavailable, letting request through", "scope", scope, "err", err)
+			return c.Next()
+		}
+
+		reset := strconv.Itoa(int(math.Ceil(res.Reset.Seconds())))
+		c.Set("RateLimit-Policy", policy)
+		c.Set("RateLimit-Limit", strconv.Itoa(limit.Limit))
+		c.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		c.Set("RateLimit-Reset", reset)
+		if !res.Allowed {
+			rateLimitDecisions.WithLabelValues(scope, "limited").Inc()
+			c.Set(fiber.HeaderRetryAfter, reset)
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": "Too many requests"})
+		}
+		rateLimitDecisions.WithLabelValues(scope, "allowed").Inc()
+		return c.Next()
+	}
+}
+
+// clientKey identifies the client by its API key when it sends a known one,
+// by its IP otherwise. Keys are hashed so they never reach Redis.
+func clientKey(cfg *Config, c *fiber.Ctx) string {
+	if key := c.Get(apiKeyHeader); key != "" && cfg.APIKeys[key] {
+		sum := sha256.Sum256([]byte(key))
+		return "key:" + hex.EncodeToString(sum[:8])
+	}
+	return "ip:" + c.IP()
+}
@@ -0,0 +1,206 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"github.com/MagnunAVF/url-shortener/internal"
+	applog "github.com/MagnunAVF/url-shortener/internal/logger"
+)
+
+const (
+	cacheKeyPrefix = "url:"
+	// TTL of moderately popular links, see popularityTTL
+	cacheTTL = 1 * time.Hour
+	// Cached entries expire within ±cacheTTLJitter of their TTL, so links
+	// cached together (e.g. after a flush) don't all expire together.
+	cacheTTLJitter = 0.2
+	// Codes known not to exist are cached briefly so scanners can't keep
+	// hammering Postgres, while a code created meanwhile shows up quickly.
+	negativeCacheTTL = 1 * time.Minute
+	// Stored in place of the destination for unknown codes; can't collide
+	// with a real URL.
+	notFoundSentinel = "\x00not-found"
+)
+
+var (
+	errLinkNotFound = errors.New("short URL not found")
+	errDatabase     = errors.New("database error")
+	errBreakerOpen  = errors.New("redis circuit breaker open")
+)
+
+// Collapses concurrent cache misses for the same code into one DB query
+var lookups singleflight.Group
+
+// cachedLink is what redirects need to know about a short code. The shared
+// cache holds it as JSON, or notFoundSentinel for unknown codes.
+type cachedLink struct {
+	LongURL string `json:"url"`
+	// Never the hash itself: the password is checked against storage
+	Protected    bool `json:"protected,omitempty"`
+	Interstitial bool `json:"interstitial,omitempty"`
+	// Zero in entries cached before links had one, meaning 302
+	RedirectStatus int                `json:"status,omitempty"`
+	QueryMode      internal.QueryMode `json:"query,omitempty"`
+	UTM            internal.UTM       `json:"utm,omitzero"`
+	// Shown by the preview page. Zero in entries cached before links carried
+	// them; ClickCount is as of when the link was cached.
+	CreatedAt  time.Time `json:"created,omitzero"`
+	ClickCount int64     `json:"clicks,omitempty"`
+}
+
+var notFoundLink = cachedLink{LongURL: notFoundSentinel}
+
+func newCachedLink(link internal.LinkClicks) cachedLink {
+	return cachedLink{
+		LongURL:        link.LongURL,
+		Protected:      link.PasswordHash != "",
+		Interstitial:   link.Interstitial,
+		RedirectStatus: link.RedirectStatus,
+		QueryMode:      link.QueryMode,
+		UTM:            link.UTM,
+		CreatedAt:      link.CreatedAt,
+		ClickCount:     link.ClickCount,
+	}
+}
+
+func (l cachedLink) encode() string {
+	if l == notFoundLink {
+		return notFoundSentinel
+	}
+	b, _ := json.Marshal(l)
+	return string(b)
+}
+
+// decodeCachedLink also accepts the bare destinations cached before links
+// had attributes.
+func decodeCachedLink(val string) cachedLink {
+	var l cachedLink
+	if strings.HasPrefix(val, "{") && json.Unmarshal([]byte(val), &l) == nil {
+		return l
+	}
+	return cachedLink{LongURL: val}
+}
+
+// resolveLink returns what shortCode points to, reading through the local
+// and Redis caches. Redis is optional: when it fails the lookup goes to
+// Postgres. Errors wrap errLinkNotFound or errDatabase.
+func resolveLink(ctx context.Context, cfg *Config, shortCode string) (cachedLink, error) {
+	if link, ok := cfg.LocalCache.Get(shortCode); ok {
+		localCacheLookups.WithLabelValues("hit").Inc()
+		if link == notFoundLink {
+			return cachedLink{}, errLinkNotFound
+		}
+		return link, nil
+	}
+	localCacheLookups.WithLabelValues("miss").Inc()
+
+	val, err := cacheGet(ctx, cfg, cacheKeyPrefix+shortCode)
+	switch {
+	case err == nil && val == notFoundSentinel:
+		cacheLookups.WithLabelValues("negative_hit").Inc()
+		cfg.LocalCache.Add(shortCode, notFoundLink)
+		return cachedLink{}, errLinkNotFound
+	case err == nil:
+		cacheLookups.WithLabelValues("hit").Inc()
+		link := decodeCachedLink(val)
+		cfg.LocalCache.Add(shortCode, link)
+		return link, nil
+	case errors.Is(err, internal.ErrCacheMiss):
+		cacheLookups.WithLabelValues("miss").Inc()
+	case errors.Is(err, errBreakerOpen):
+		// Redis is known to be down: serve from Postgres without waiting
+		cacheLookups.WithLabelValues("skipped").Inc()
+		redisDegraded.WithLabelValues("breaker_open").Inc()
+	default:
+		cacheLookups.WithLabelValues("error").Inc()
+		redisDegraded.WithLabelValues("error").Inc()
+		applog.FromContext(ctx).Warn("Cache unavailable, falling back to database", "err", err)
+	}
+
+	// The leader's request may go away before followers are served, so the
+	// shared lookup must not be cancelled with it.
+	v, err, _ := lookups.Do(shortCode, func() (interface{}, error) {
+		return loadLink(context.WithoutCancel(ctx), cfg, shortCode)
+	})
+	if err != nil {
+		return cachedLink{}, err
+	}
+	return v.(cachedLink), nil
+}
+
+// loadLink reads shortCode from storage and caches the outcome, found or
+// not. Found links are cached for longer the more they are clicked.
+func loadLink(ctx context.Context, cfg *Config, shortCode string) (cachedLink, error) {
+	cacheKey := cacheKeyPrefix + shortCode
+
+	link, err := cfg.Links.FindByCode(ctx, shortCode)
+	if errors.Is(err, internal.ErrLinkNotFound) {
+		if err := cacheSet(ctx, cfg, cacheKey, notFoundSentinel, negativeCacheTTL); err != nil && !errors.Is(err, errBreakerOpen) {
+			applog.FromContext(ctx).Error("Error setting negative cache", "err", err)
+		}
+		cfg.LocalCache.Add(shortCode, notFoundLink)
+		return cachedLink{}, errLinkNotFound
+	} else if err != nil {
+		return cachedLink{}, fmt.Errorf("%w: %w", errDatabase, err)
+	}
+
+	cached := newCachedLink(link)
+	if err := cacheSet(ctx, cfg, cacheKey, cached.encode(), popularityTTL(link.ClickCount)); err != nil && !errors.Is(err, errBreakerOpen) {
+		applog.FromContext(ctx).Error("Error setting cache", "err", err)
+	}
+	cfg.LocalCache.Add(shortCode, cached)
+	return cached, nil
+}
+
+// jitteredTTL spreads ttl uniformly over ±cacheTTLJitter.
+func jitteredTTL(ttl time.Duration) time.Duration {
+	spread := float64(ttl) * cacheTTLJitter
+	return ttl + time.Duration((rand.Float64()*2-1)*spread)
+}
+
+// cacheGet reads key from the shared cache through the circuit breaker.
+func cacheGet(ctx context.Context, cfg *Config, key string) (string, error) {
+	if !cfg.RedisBreaker.Allow() {
+		return "", errBreakerOpen
+	}
+	val, err := cfg.Cache.Get(ctx, key)
+	recordRedisResult(cfg, err)
+	return val, err
+}
+
+// cacheSet writes key to the shared cache through the circuit breaker.
+func cacheSet(ctx context.Context, cfg *Config, key, val string, ttl time.Duration) error {
+	if !cfg.RedisBreaker.Allow() {
+		return errBreakerOpen
+	}
+	err := cfg.Cache.Set(ctx, key, val, ttl)
+	recordRedisResult(cfg, err)
+	return err
+}
+
+func recordRedisResult(cfg *Config, err error) {
+	if err == nil || errors.Is(err, internal.ErrCacheMiss) {
+		cfg.RedisBreaker.Success()
+	} else {
+		cfg.RedisBreaker.Failure()
+	}
+}
+
+// onRedisBreakerChange logs and exposes breaker transitions.
+func onRedisBreakerChange(from, to internal.BreakerState) {
+	redisBreakerState.Set(float64(to))
+	if to == internal.BreakerOpen {
+		slog.Warn("Redis circuit breaker opened, serving redirects from the database", "from", from.String())
+		return
+	}
+	slog.Info("Redis circuit breaker state changed", "from", from.String(), "to", to.String())
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/MagnunAVF/url-shortener/internal"
+)
+
+// Longest chain of short links followed to reach a final destination
+const maxUnwrapHops = 5
+
+// unwrapDestination returns the final target of longURL when it points to
+// one of our own short links or to another shortener, so links never
+// chain. Our links are resolved from storage; other shorteners are either
+// rejected or, when cfg.UnwrapShorteners is set, asked for their redirect.
+// Only hosts on the shortener list are ever contacted. flagged is set when
+// one of our links on the way shows the interstitial, which the new link
+// must keep doing. Errors wrapping internal.ErrInvalidURL read well as API
+// error messages.
+func unwrapDestination(ctx context.Context, cfg *Config, longURL string) (dest string, flagged bool, err error) {
+	seen := map[string]bool{longURL: true}
+	for hop := 0; hop < maxUnwrapHops; hop++ {
+		u, err := url.Parse(longURL)
+		if err != nil {
+			return "", false, fmt.Errorf("%w: malformed", internal.ErrInvalidURL)
+		}
+
+		var next string
+		switch {
+		case cfg.SelfHost != "" && u.Host == cfg.SelfHost:
+			var interstitial bool
+			next, interstitial, err = resolveOwnLink(ctx, cfg, u)
+			flagged = flagged || interstitial
+		case matchesDomain(strings.ToLower(u.Hostname()), cfg.Shorteners):
+			if !cfg.UnwrapShorteners {
+				return "", false, fmt.Errorf("%w: links to other URL shorteners (%s) are not allowed, use the final destination", internal.ErrInvalidURL, u.Hostname())
+			}
+			next, err = followShortener(ctx, cfg, u)
+		default:
+			return longURL, flagged, nil
+		}
+		if err != nil {
+			return "", false, err
+		}
+
+		if next, err = cfg.URLs.Normalize(next); err != nil {
+			return "", false, fmt.Errorf("%s resolves to an unusable destination: %w", longURL, err)
+		}
+		if seen[next] {
+			return "", false, fmt.Errorf("%w: redirect loop through %s", internal.ErrInvalidURL, next)
+		}
+		seen[next] = true
+		longURL = next
+	}
+	return "", false, fmt.Errorf("%w: more than %d chained short links", internal.ErrInvalidURL, maxUnwrapHops)
+}
+
+// resolveOwnLink returns where the short link u, which points to this
+// service, redirects: its destination with its UTM parameters and u's
+// query string applied as a redirect would, and whether it shows the
+// interstitial.
+func resolveOwnLink(ctx context.Context, cfg *Config, u *url.URL) (string, bool, error) {
+	// A preview URL still names the link
+	shortCode := strings.TrimSuffix(strings.TrimPrefix(u.Path, "/"), "+")
+	if shortCode == "" || strings.Contains(shortCode, "/") {
+		return "", false, fmt.Errorf("%w: can't point to this service", internal.ErrInvalidURL)
+	}
+	link, err := cfg.Links.FindByCode(ctx, shortCode)
+	if errors.Is(err, internal.ErrLinkNotFound) {
+		return "", false, fmt.Errorf("%w: points to short link %s, which doesn't exist", internal.ErrInvalidURL, shortCode)
+	} else if err != nil {
+		return "", false, err
+	}
+	// Resolving it would hand out the destination without the password
+	if link.PasswordHash != "" {
+		return "", false, fmt.Errorf("%w: points to short link %s, which is password protected", internal.ErrInvalidURL, shortCode)
+	}
+	return internal.MergeQuery(link.UTM.Apply(link.LongURL), u.RawQuery, link.QueryMode, "preview"), link.Interstitial, nil
+}
+
+// followShortener asks another shortener where u redirects to, without
+// following the redirect.
+func followShortener(ctx context.Context, cfg *Config, u *url.URL) (string, error) {
+	// Some shorteners answer HEAD with 405 or 200, GET is the fallback
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+		if err != nil {
+			return "", fmt.Errorf("%w: malformed", internal.ErrInvalidURL)
+		}
+		resp, err := cfg.UnwrapClient.Do(req)
+		if err != nil {
+			return "", fmt.Errorf("%w: could not reach %s to find the final destination", internal.ErrInvalidURL, u.Host)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode >= 300 && resp.StatusCode < 400 {
+			loc, err := resp.Location()
+			if err != nil {
+				break
+			}
+			return loc.String(), nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s does not redirect anywhere", internal.ErrInvalidURL, u.String())
+}
+
+// matchesDomain reports whether host is one of domains or a subdomain of
+// one.
+func matchesDomain(host string, domains map[string]bool) bool {
+	for d := host; d != ""; {
+		if domains[d] {
+			return true
+		}
+		_, d, _ = strings.Cut(d, ".")
+	}
+	return false
+}
+
+// newUnwrapClient returns the client asking other shorteners for their
+// redirects. It never follows them itself: every hop is checked against the
+// shortener list first.
+func newUnwrapClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// selfHost returns the host of appDomain as destinations are normalized,
+// empty when it isn't a valid web URL.
+func selfHost(appDomain string) string {
+	policy := internal.URLPolicy{AllowedSchemes: []string{"http", "https"}, MaxLength: len(appDomain) + 1}
+	normalized, err := policy.Normalize(appDomain)
+	if err != nil {
+		return ""
+	}
+	u, err := url.Parse(normalized)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
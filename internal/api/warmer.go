@@ -0,0 +1,85 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"time"
+
+	"github.com/MagnunAVF/url-shortener/internal"
+)
+
+const (
+	cacheWarmLockKey = "url:warm:lock"
+
+	// Popularity tiers by total clicks: hot links stay cached for a day,
+	// cold ones make room quickly.
+	hotClickThreshold  = 1000
+	warmClickThreshold = 50
+	hotCacheTTL        = 24 * time.Hour
+	coldCacheTTL       = 10 * time.Minute
+)
+
+// popularityTTL picks the cache TTL of a link from its click count, with jitter.
+func popularityTTL(clicks int64) time.Duration {
+	switch {
+	case clicks >= hotClickThreshold:
+		return jitteredTTL(hotCacheTTL)
+	case clicks >= warmClickThreshold:
+		return jitteredTTL(cacheTTL)
+	default:
+		return jitteredTTL(coldCacheTTL)
+	}
+}
+
+// warmCache loads the topN most clicked links into the shared url: keyspace.
+// Replicas share the cache, so only one of them warms per interval.
+func warmCache(ctx context.Context, cfg *Config, topN int, interval time.Duration) error {
+	if cfg.RedisBreaker.State() == internal.BreakerOpen {
+		return errBreakerOpen
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	// Never released: the lock expiring is what schedules the next run
+	ok, err := cfg.Cache.SetNX(ctx, cacheWarmLockKey, hex.EncodeToString(buf), interval-interval/10)
+	recordRedisResult(cfg, err)
+	if err != nil || !ok {
+		return err
+	}
+
+	links, err := cfg.Links.TopClicked(ctx, topN)
+	if err != nil {
+		return err
+	}
+	if len(links) == 0 {
+		return nil
+	}
+	// Through the breaker: once Redis fails, the remaining links wait for
+	// the next run instead of each timing out.
+	for _, link := range links {
+		if err := cacheSet(ctx, cfg, cacheKeyPrefix+link.ShortCode, newCachedLink(link).encode(), popularityTTL(link.ClickCount)); err != nil {
+			return err
+		}
+	}
+
+	slog.Info("Warmed redirect cache", "links", len(links))
+	return nil
+}
+
+// runCacheWarmer warms the cache on startup, then every interval.
+func runCacheWarmer(ctx context.Context, cfg *Config, topN int, interval time.Duration) {
+	for {
+		if err := warmCache(ctx, cfg, topN, interval); err != nil {
+			slog.Error("Failed to warm redirect cache", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
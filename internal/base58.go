@@ -37,3 +37,24 @@ func EncodeID(id uint64) string {
 
 	return string(runes)
 }
+
+// DecodeID is the inverse of EncodeID; ok is false when code isn't a
+// Base58 encoded uint64.
+func DecodeID(code string) (id uint64, ok bool) {
+	if code == "" {
+		return 0, false
+	}
+	num := new(big.Int)
+	for i := 0; i < len(code); i++ {
+		digit := strings.IndexByte(alphabet, code[i])
+		if digit < 0 {
+			return 0, false
+		}
+		num.Mul(num, bigBase)
+		num.Add(num, big.NewInt(int64(digit)))
+	}
+	if !num.IsUint64() {
+		return 0, false
+	}
+	return num.Uint64(), true
+}
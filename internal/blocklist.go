@@ -0,0 +1,243 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/idna"
+)
+
+var (
+	ErrInvalidPattern = errors.New("invalid blocklist pattern")
+	ErrNotBlocked     = errors.New("pattern is not blocked")
+)
+
+var patternRe = regexp.MustCompile(`^[a-z0-9*_-]+(\.[a-z0-9*_-]+)*$`)
+
+// Where a blocklist entry comes from
+const (
+	BlockSourceFile  = "file"
+	BlockSourceStore = "store"
+)
+
+// BlockedDomain is a blocklist entry, see NormalizePattern for the syntax.
+type BlockedDomain struct {
+	Pattern   string    `gorm:"primaryKey;type:varchar(253)" json:"pattern"`
+	Reason    string    `gorm:"type:text;not null;default:''" json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+	Source    string    `gorm:"-" json:"source"`
+}
+
+// BlocklistStore keeps the blocklist entries managed through the API.
+type BlocklistStore interface {
+	ListBlocked(ctx context.Context) ([]BlockedDomain, error)
+	// Block adds entry, replacing the reason of an existing pattern.
+	Block(ctx context.Context, entry *BlockedDomain) error
+	// Unblock returns ErrNotBlocked when pattern isn't in the store.
+	Unblock(ctx context.Context, pattern string) error
+}
+
+// NormalizePattern validates a blocklist pattern and returns its canonical
+// form. A plain domain blocks itself and every subdomain; "*" matches any
+// run of characters, dots included, so "*.example.com" blocks subdomains
+// only and "paypal-*.com" a family of lookalikes.
+func NormalizePattern(raw string) (string, error) {
+	p := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(raw)), ".")
+	labels := strings.Split(p, ".")
+	literal := false
+	for i, label := range labels {
+		if strings.Contains(label, "*") {
+			continue
+		}
+		ascii, err := idna.Lookup.ToASCII(label)
+		if err != nil {
+			return "", fmt.Errorf("%w: %q", ErrInvalidPattern, raw)
+		}
+		labels[i] = ascii
+		literal = true
+	}
+	p = strings.Join(labels, ".")
+	if !patternRe.MatchString(p) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidPattern, raw)
+	}
+	// "*" or "*.*" would block every destination
+	if !literal {
+		return "", fmt.Errorf("%w: %q needs at least one literal label", ErrInvalidPattern, raw)
+	}
+	return p, nil
+}
+
+// Blocklist matches destination hosts against the patterns of an optional
+// file and an optional store. Reload picks up changes of either; readers
+// always see a complete list.
+type Blocklist struct {
+	file  string
+	store BlocklistStore
+
+	mu      sync.RWMutex
+	domains map[string]string // literal patterns, by domain
+	globs   []string
+	entries []BlockedDomain
+	fileMod time.Time
+}
+
+// NewBlocklist returns an empty blocklist; call Reload to load it. file and
+// store may be empty and nil.
+func NewBlocklist(file string, store BlocklistStore) *Blocklist {
+	return &Blocklist{file: file, store: store, domains: make(map[string]string)}
+}
+
+// Store is where entries added through the API go, nil when there is none.
+func (b *Blocklist) Store() BlocklistStore {
+	return b.store
+}
+
+// Reload reads the file, only when it changed since the last reload, and
+// the store, then swaps the new list in. On error the current list stays.
+func (b *Blocklist) Reload(ctx context.Context) error {
+	b.mu.RLock()
+	fileEntries, fileMod := b.fileEntries(), b.fileMod
+	b.mu.RUnlock()
+
+	if b.file != "" {
+		info, err := os.Stat(b.file)
+		if err != nil {
+			return fmt.Errorf("failed to read blocklist file: %w", err)
+		}
+		if !info.ModTime().Equal(fileMod) {
+			f, err := os.Open(b.file)
+			if err != nil {
+				return fmt.Errorf("failed to read blocklist file: %w", err)
+			}
+			fileEntries, err = parseBlocklist(f, info.ModTime())
+			f.Close()
+			if err != nil {
+				return fmt.Errorf("blocklist file %s: %w", b.file, err)
+			}
+			fileMod = info.ModTime()
+		}
+	}
+
+	var stored []BlockedDomain
+	if b.store != nil {
+		var err error
+		if stored, err = b.store.ListBlocked(ctx); err != nil {
+			return fmt.Errorf("failed to load blocklist: %w", err)
+		}
+		for i := range stored {
+			stored[i].Source = BlockSourceStore
+		}
+	}
+
+	entries := append(fileEntries, stored...)
+	domains := make(map[string]string, len(entries))
+	var globs []string
+	for _, e := range entries {
+		if strings.Contains(e.Pattern, "*") {
+			globs = append(globs, e.Pattern)
+		} else {
+			domains[e.Pattern] = e.Pattern
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Pattern < entries[j].Pattern })
+
+	b.mu.Lock()
+	b.domains, b.globs, b.entries, b.fileMod = domains, globs, entries, fileMod
+	b.mu.Unlock()
+	return nil
+}
+
+// fileEntries returns the entries loaded from the file. Callers hold mu.
+func (b *Blocklist) fileEntries() []BlockedDomain {
+	var out []BlockedDomain
+	for _, e := range b.entries {
+		if e.Source == BlockSourceFile {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// Entries returns every entry, sorted by pattern.
+func (b *Blocklist) Entries() []BlockedDomain {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return append([]BlockedDomain(nil), b.entries...)
+}
+
+// Match returns the pattern blocking host, if any. host is expected in the
+// normalized form links are stored in: lowercase, punycode.
+func (b *Blocklist) Match(host string) (string, bool) {
+	host = strings.TrimSuffix(host, ".")
+	if host == "" {
+		return "", false
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	// The host itself, then every parent domain
+	for d := host; ; {
+		if p, ok := b.domains[d]; ok {
+			return p, true
+		}
+		_, parent, ok := strings.Cut(d, ".")
+		if !ok {
+			break
+		}
+		d = parent
+	}
+	for _, g := range b.globs {
+		// Patterns hold no '/', so path.Match's '*' spans dots too
+		if ok, _ := path.Match(g, host); ok {
+			return g, true
+		}
+	}
+	return "", false
+}
+
+// MatchURL is Match on the host of a destination URL. URLs without a host,
+// like app deep links, never match.
+func (b *Blocklist) MatchURL(rawURL string) (string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", false
+	}
+	return b.Match(strings.ToLower(u.Hostname()))
+}
+
+// parseBlocklist reads one pattern per line, optionally followed by a
+// reason after whitespace. Blank lines and lines starting with # are
+// skipped.
+func parseBlocklist(r io.Reader, modTime time.Time) ([]BlockedDomain, error) {
+	var entries []BlockedDomain
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		pattern, err := NormalizePattern(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		entries = append(entries, BlockedDomain{
+			Pattern:   pattern,
+			Reason:    strings.Join(fields[1:], " "),
+			CreatedAt: modTime,
+			Source:    BlockSourceFile,
+		})
+	}
+	return entries, scanner.Err()
+}
@@ -0,0 +1,44 @@
+package internal
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/plugin/dbresolver"
+)
+
+// SQLBlocklistStore keeps blocklist entries in the blocked_domains table.
+type SQLBlocklistStore struct {
+	db *gorm.DB
+}
+
+func NewSQLBlocklistStore(db *gorm.DB) *SQLBlocklistStore {
+	return &SQLBlocklistStore{db: db}
+}
+
+// ListBlocked reads from the primary, so a reload triggered by a change
+// sees it. The table is small and read once per reload.
+func (s *SQLBlocklistStore) ListBlocked(ctx context.Context) ([]BlockedDomain, error) {
+	var entries []BlockedDomain
+	err := s.db.WithContext(ctx).Clauses(dbresolver.Write).Order("pattern").Find(&entries).Error
+	return entries, err
+}
+
+func (s *SQLBlocklistStore) Block(ctx context.Context, entry *BlockedDomain) error {
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "pattern"}},
+		DoUpdates: clause.AssignmentColumns([]string{"reason"}),
+	}).Create(entry).Error
+}
+
+func (s *SQLBlocklistStore) Unblock(ctx context.Context, pattern string) error {
+	res := s.db.WithContext(ctx).Where("pattern = ?", pattern).Delete(&BlockedDomain{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotBlocked
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNormalizePattern(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{"domain", "example.com", "example.com", false},
+		{"uppercase", "Evil.Example.COM", "evil.example.com", false},
+		{"surrounding space", "  example.com  ", "example.com", false},
+		{"trailing dot", "example.com.", "example.com", false},
+		{"idn", "bücher.example", "xn--bcher-kva.example", false},
+		{"subdomain glob", "*.example.com", "*.example.com", false},
+		{"lookalike glob", "paypal-*.com", "paypal-*.com", false},
+		{"glob only", "*", "", true},
+		{"globs only", "*.*", "", true},
+		{"empty", "", "", true},
+		{"empty label", "example..com", "", true},
+		{"url", "https://example.com/", "", true},
+		{"path", "example.com/phish", "", true},
+		{"port", "example.com:8080", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizePattern(tt.raw)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidPattern) {
+					t.Fatalf("NormalizePattern(%q) = %q, %v, want ErrInvalidPattern", tt.raw, got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("NormalizePattern(%q) = %q, %v, want %q", tt.raw, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestBlocklistMatch(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "blocklist.txt")
+	patterns := "# phishing\nevil.example malware host\n*.tracker.example\npaypal-*.com\n"
+	if err := os.WriteFile(file, []byte(patterns), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	b := NewBlocklist(file, nil)
+	if err := b.Reload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		host    string
+		want    string
+		blocked bool
+	}{
+		{"domain", "evil.example", "evil.example", true},
+		{"trailing dot", "evil.example.", "evil.example", true},
+		{"subdomain", "login.evil.example", "evil.example", true},
+		{"deep subdomain", "a.b.evil.example", "evil.example", true},
+		{"parent domain", "example", "", false},
+		{"suffix without dot", "notevil.example", "", false},
+		{"subdomain glob", "px.tracker.example", "*.tracker.example", true},
+		{"subdomain glob spans dots", "a.px.tracker.example", "*.tracker.example", true},
+		{"subdomain glob skips apex", "tracker.example", "", false},
+		{"lookalike glob", "paypal-secure.com", "paypal-*.com", true},
+		{"lookalike glob spans dots", "paypal-login.account.com", "paypal-*.com", true},
+		{"lookalike glob other tld", "paypal-secure.net", "", false},
+		{"unrelated", "example.com", "", false},
+		{"empty", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, blocked := b.Match(tt.host)
+			if got != tt.want || blocked != tt.blocked {
+				t.Errorf("Match(%q) = %q, %v, want %q, %v", tt.host, got, blocked, tt.want, tt.blocked)
+			}
+		})
+	}
+}
+
+func TestBlocklistMatchURL(t *testing.T) {
+	b := NewBlocklist("", nil)
+	b.domains["evil.example"] = "evil.example"
+
+	tests := []struct {
+		url     string
+		blocked bool
+	}{
+		{"https://login.evil.example/path", true},
+		{"https://LOGIN.Evil.Example:8443/", true},
+		{"https://example.com/?next=https://evil.example/", false},
+		{"mailto:someone@evil.example", false},
+	}
+	for _, tt := range tests {
+		if _, blocked := b.MatchURL(tt.url); blocked != tt.blocked {
+			t.Errorf("MatchURL(%q) blocked = %v, want %v", tt.url, blocked, tt.blocked)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package internal
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+type TrafficClass string
+
+const (
+	TrafficHuman TrafficClass = "human"
+	TrafficBot   TrafficClass = "bot"
+)
+
+//go:embed bot_user_agents.txt
+var defaultBotPatterns string
+
+// ClickSignals are the request attributes used to tell humans from bots.
+type ClickSignals struct {
+	Method    string
+	UserAgent string
+	Accept    string
+	// Purpose is the value of the first prefetch/preview hint header found
+	// (Sec-Purpose, Purpose, X-Purpose or X-Moz).
+	Purpose string
+}
+
+// BotDetector classifies clicks using User-Agent patterns and request heuristics.
+type BotDetector struct {
+	patterns []string
+}
+
+// NewBotDetector loads the embedded pattern list, plus the patterns in
+// extraFile when it is not empty.
+func NewBotDetector(extraFile string) (*BotDetector, error) {
+	patterns, err := parseBotPatterns(strings.NewReader(defaultBotPatterns))
+	if err != nil {
+		return nil, err
+	}
+
+	if extraFile != "" {
+		f, err := os.Open(extraFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open bot patterns file: %w", err)
+		}
+		defer f.Close()
+
+		extra, err := parseBotPatterns(f)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, extra...)
+	}
+
+	return &BotDetector{patterns: patterns}, nil
+}
+
+func (d *BotDetector) Classify(s ClickSignals) TrafficClass {
+	// Link unfurlers commonly probe with HEAD, real browsers never do
+	if strings.EqualFold(s.Method, "HEAD") {
+		return TrafficBot
+	}
+	if s.Purpose != "" {
+		return TrafficBot
+	}
+	// Every browser sends Accept on navigation
+	if strings.TrimSpace(s.Accept) == "" {
+		return TrafficBot
+	}
+
+	ua := strings.ToLower(strings.TrimSpace(s.UserAgent))
+	if ua == "" || ua == "unknown" {
+		return TrafficBot
+	}
+	for _, p := range d.patterns {
+		if strings.Contains(ua, p) {
+			return TrafficBot
+		}
+	}
+
+	return TrafficHuman
+}
+
+func parseBotPatterns(r io.Reader) ([]string, error) {
+	var patterns []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.ToLower(strings.TrimSpace(line))
+		if line != "" {
+			patterns = append(patterns, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read bot patterns: %w", err)
+	}
+	return patterns, nil
+}
@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"sync"
+	"time"
+)
+
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// CircuitBreaker stops calls to a failing dependency. It opens after
+// maxFailures consecutive failures, rejects calls for cooldown, then lets a
+// single probe through: success closes it again, failure reopens it.
+type CircuitBreaker struct {
+	maxFailures int
+	cooldown    time.Duration
+	// Called on every state transition, outside the lock
+	onChange func(from, to BreakerState)
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func NewCircuitBreaker(maxFailures int, cooldown time.Duration, onChange func(from, to BreakerState)) *CircuitBreaker {
+	return &CircuitBreaker{maxFailures: maxFailures, cooldown: cooldown, onChange: onChange}
+}
+
+// Allow reports whether a call may go through. Every allowed call must be
+// followed by Success or Failure.
+func (b *CircuitBreaker) Allow() bool {
+	b.mu.Lock()
+	from := b.state
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			b.mu.Unlock()
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+		b.mu.Unlock()
+		b.notify(from, BreakerHalfOpen)
+		return true
+	case BreakerHalfOpen:
+		if b.probing {
+			b.mu.Unlock()
+			return false
+		}
+		b.probing = true
+	}
+	b.mu.Unlock()
+	return true
+}
+
+func (b *CircuitBreaker) Success() {
+	b.mu.Lock()
+	from := b.state
+	b.state = BreakerClosed
+	b.failures = 0
+	b.probing = false
+	b.mu.Unlock()
+	b.notify(from, BreakerClosed)
+}
+
+func (b *CircuitBreaker) Failure() {
+	b.mu.Lock()
+	from := b.state
+	b.failures++
+	b.probing = false
+	if b.state == BreakerHalfOpen || b.failures >= b.maxFailures {
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+	}
+	to := b.state
+	b.mu.Unlock()
+	b.notify(from, to)
+}
+
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+func (b *CircuitBreaker) notify(from, to BreakerState) {
+	if from != to && b.onChange != nil {
+		b.onChange(from, to)
+	}
+}
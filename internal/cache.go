@@ -0,0 +1,35 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrCacheMiss = errors.New("cache miss")
+
+// Cache is the cache shared by API replicas, along with the pub/sub channel
+// they use to tell each other about changed links.
+type Cache interface {
+	// Get returns ErrCacheMiss when key isn't cached.
+	Get(ctx context.Context, key string) (string, error)
+	Set(ctx context.Context, key, value string, ttl time.Duration) error
+	// SetNX sets key only if it doesn't exist yet, reporting whether it did.
+	SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error)
+	Delete(ctx context.Context, key string) error
+	Publish(ctx context.Context, channel, message string) error
+	// Subscribe delivers messages published on channel until ctx is done.
+	Subscribe(ctx context.Context, channel string) <-chan string
+	Ping(ctx context.Context) error
+}
+
+// ClickStats serves the near-real-time analytics that live next to the
+// cache rather than in the LinkStore.
+type ClickStats interface {
+	// UniqueCounts returns the approximate number of distinct visitors in
+	// the union of each group of UniqueVisitorsKey keys.
+	UniqueCounts(ctx context.Context, groups ...[]string) ([]int64, error)
+	// PendingClicks returns the click deltas of shortCode not persisted to
+	// the LinkStore yet.
+	PendingClicks(ctx context.Context, shortCode string) (PendingClicks, error)
+}
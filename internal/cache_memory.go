@@ -0,0 +1,205 @@
+package internal
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Expired entries are only dropped when read, plus a full sweep at most
+// this often so entries nobody reads again don't pile up.
+const memorySweepInterval = 1 * time.Minute
+
+// MemoryCache implements Cache, ClickStats and RateLimiter in process memory, for tests
+// and single-process setups. Unique visitors are counted exactly, and there
+// are never pending clicks since nothing aggregates in the cache.
+type MemoryCache struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+	subs    map[string][]chan string
+	// Visitor IDs per UniqueVisitorsKey
+	visitors  map[string]*visitorSet
+	rates     map[string]*rateCounter
+	nextSweep time.Time
+}
+
+type visitorSet struct {
+	ids       map[string]struct{}
+	expiresAt time.Time
+}
+
+type memoryEntry struct {
+	value string
+	// Zero never expires
+	expiresAt time.Time
+}
+
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{
+		entries:  make(map[string]memoryEntry),
+		subs:     make(map[string][]chan string),
+		visitors: make(map[string]*visitorSet),
+		rates:    make(map[string]*rateCounter),
+	}
+}
+
+func (c *MemoryCache) Get(ctx context.Context, key string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.lookup(key)
+	if !ok {
+		return "", ErrCacheMiss
+	}
+	return e.value, nil
+}
+
+func (c *MemoryCache) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sweep()
+	c.entries[key] = newMemoryEntry(value, ttl)
+	return nil
+}
+
+func (c *MemoryCache) SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sweep()
+	if _, ok := c.lookup(key); ok {
+		return false, nil
+	}
+	c.entries[key] = newMemoryEntry(value, ttl)
+	return true, nil
+}
+
+func (c *MemoryCache) Delete(ctx context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+	return nil
+}
+
+// Publish drops the message for subscribers whose buffer is full.
+func (c *MemoryCache) Publish(ctx context.Context, channel, message string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, ch := range c.subs[channel] {
+		select {
+		case ch <- message:
+		default:
+		}
+	}
+	return nil
+}
+
+func (c *MemoryCache) Subscribe(ctx context.Context, channel string) <-chan string {
+	ch := make(chan string, 1000)
+	c.mu.Lock()
+	c.subs[channel] = append(c.subs[channel], ch)
+	c.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		subs := c.subs[channel]
+		for i, sub := range subs {
+			if sub == ch {
+				c.subs[channel] = append(subs[:i], subs[i+1:]...)
+				break
+			}
+		}
+		close(ch)
+	}()
+	return ch
+}
+
+func (c *MemoryCache) Ping(ctx context.Context) error {
+	return nil
+}
+
+// AddUniqueVisitor records visitorID under the UniqueVisitorsKey key, which
+// is forgotten ttl after its last addition.
+func (c *MemoryCache) AddUniqueVisitor(key, visitorID string, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sweep()
+	set, ok := c.visitors[key]
+	if !ok {
+		set = &visitorSet{ids: make(map[string]struct{})}
+		c.visitors[key] = set
+	}
+	set.ids[visitorID] = struct{}{}
+	set.expiresAt = time.Now().Add(ttl)
+}
+
+func (c *MemoryCache) UniqueCounts(ctx context.Context, groups ...[]string) ([]int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counts := make([]int64, len(groups))
+	for i, keys := range groups {
+		union := make(map[string]struct{})
+		for _, key := range keys {
+			set, ok := c.visitors[key]
+			if !ok || time.Now().After(set.expiresAt) {
+				continue
+			}
+			for id := range set.ids {
+				union[id] = struct{}{}
+			}
+		}
+		counts[i] = int64(len(union))
+	}
+	return counts, nil
+}
+
+func (c *MemoryCache) PendingClicks(ctx context.Context, shortCode string) (PendingClicks, error) {
+	return PendingClicks{
+		Pending:  URLAnalytics{ShortCode: shortCode},
+		Flushing: URLAnalytics{ShortCode: shortCode},
+	}, nil
+}
+
+// lookup returns the live entry of key, evicting it if expired. Callers
+// hold c.mu.
+func (c *MemoryCache) lookup(key string) (memoryEntry, bool) {
+	e, ok := c.entries[key]
+	if ok && !e.expiresAt.IsZero() && time.Now().After(e.expiresAt) {
+		delete(c.entries, key)
+		return memoryEntry{}, false
+	}
+	return e, ok
+}
+
+// sweep drops every expired entry, visitor set and rate counter, at most once per
+// memorySweepInterval. Callers hold c.mu.
+func (c *MemoryCache) sweep() {
+	now := time.Now()
+	if now.Before(c.nextSweep) {
+		return
+	}
+	c.nextSweep = now.Add(memorySweepInterval)
+	for key, e := range c.entries {
+		if !e.expiresAt.IsZero() && now.After(e.expiresAt) {
+			delete(c.entries, key)
+		}
+	}
+	for key, set := range c.visitors {
+		if now.After(set.expiresAt) {
+			delete(c.visitors, key)
+		}
+	}
+	for key, rc := range c.rates {
+		if rc.expired(now) {
+			delete(c.rates, key)
+		}
+	}
+}
+
+func newMemoryEntry(value string, ttl time.Duration) memoryEntry {
+	e := memoryEntry{value: value}
+	if ttl > 0 {
+		e.expiresAt = time.Now().Add(ttl)
+	}
+	return e
+}
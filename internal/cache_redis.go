@@ -0,0 +1,87 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisCache implements Cache, ClickStats and RateLimiter on top of Redis.
+type RedisCache struct {
+	rdb *redis.Client
+}
+
+func NewRedisCache(rdb *redis.Client) *RedisCache {
+	return &RedisCache{rdb: rdb}
+}
+
+func (c *RedisCache) Get(ctx context.Context, key string) (string, error) {
+	val, err := c.rdb.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", ErrCacheMiss
+	}
+	return val, err
+}
+
+func (c *RedisCache) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	return c.rdb.Set(ctx, key, value, ttl).Err()
+}
+
+func (c *RedisCache) SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	return c.rdb.SetNX(ctx, key, value, ttl).Result()
+}
+
+func (c *RedisCache) Delete(ctx context.Context, key string) error {
+	return c.rdb.Del(ctx, key).Err()
+}
+
+func (c *RedisCache) Publish(ctx context.Context, channel, message string) error {
+	return c.rdb.Publish(ctx, channel, message).Err()
+}
+
+// Subscribe relies on go-redis reconnecting the subscription on its own.
+func (c *RedisCache) Subscribe(ctx context.Context, channel string) <-chan string {
+	sub := c.rdb.Subscribe(ctx, channel)
+	out := make(chan string)
+	go func() {
+		defer close(out)
+		defer sub.Close()
+		msgs := sub.Channel(redis.WithChannelSize(1000))
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-msgs:
+				if !ok {
+					return
+				}
+				out <- msg.Payload
+			}
+		}
+	}()
+	return out
+}
+
+func (c *RedisCache) Ping(ctx context.Context) error {
+	return c.rdb.Ping(ctx).Err()
+}
+
+// UniqueCounts runs one PFCOUNT per group in a single round trip. PFCOUNT
+// over several keys counts their union.
+func (c *RedisCache) UniqueCounts(ctx context.Context, groups ...[]string) ([]int64, error) {
+	pipe := c.rdb.Pipeline()
+	cmds := make([]*redis.IntCmd, len(groups))
+	for i, keys := range groups {
+		cmds[i] = pipe.PFCount(ctx, keys...)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	counts := make([]int64, len(cmds))
+	for i, cmd := range cmds {
+		counts[i] = cmd.Val()
+	}
+	return counts, nil
+}
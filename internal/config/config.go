@@ -0,0 +1,276 @@
+// Package config is the typed configuration shared by every service.
+//
+// Values come from, in increasing precedence: the defaults below, the YAML
+// file named by CONFIG_FILE (if any) and environment variables. Each field
+// names its variable in the env tag and its YAML key in the yaml tag.
+// Logging (LOG_*) and tracing (OTEL_*) are set up before configuration
+// loads and keep reading the environment on their own.
+package config
+
+import (
+	"time"
+)
+
+type Config struct {
+	App       App       `yaml:"app"`
+	HTTP      HTTP      `yaml:"http"`
+	Links     Links     `yaml:"links"`
+	Blocklist Blocklist `yaml:"blocklist"`
+	Admin     Admin     `yaml:"admin"`
+	RateLimit RateLimit `yaml:"rate_limit"`
+	Passwords Passwords `yaml:"passwords"`
+	IDService IDService `yaml:"id_service"`
+	Postgres  Postgres  `yaml:"postgres"`
+	SQLite    SQLite    `yaml:"sqlite"`
+	Redis     Redis     `yaml:"redis"`
+	RabbitMQ  RabbitMQ  `yaml:"rabbitmq"`
+	Cache     Cache     `yaml:"cache"`
+	Analytics Analytics `yaml:"analytics"`
+	Worker    Worker    `yaml:"worker"`
+}
+
+type App struct {
+	// Public base URL short links are built on
+	Domain string `yaml:"domain" env:"APP_DOMAIN"`
+	Port   string `yaml:"port" env:"API_SERVICE_PORT"`
+}
+
+// HTTP applies to every HTTP server.
+type HTTP struct {
+	ReadTimeout  time.Duration `yaml:"read_timeout" env:"HTTP_READ_TIMEOUT"`
+	WriteTimeout time.Duration `yaml:"write_timeout" env:"HTTP_WRITE_TIMEOUT"`
+	IdleTimeout  time.Duration `yaml:"idle_timeout" env:"HTTP_IDLE_TIMEOUT"`
+	// Maximum request body size in bytes
+	BodyLimit int `yaml:"body_limit" env:"HTTP_BODY_LIMIT"`
+	// Header carrying the client IP when behind a load balancer, e.g.
+	// X-Forwarded-For. Only honored from TrustedProxies, which it requires.
+	ProxyHeader    string   `yaml:"proxy_header" env:"HTTP_PROXY_HEADER"`
+	TrustedProxies []string `yaml:"trusted_proxies" env:"HTTP_TRUSTED_PROXIES"`
+}
+
+// Links constrains the destinations links may point to.
+type Links struct {
+	// Schemes beyond http and https are meant for app deep links
+	AllowedSchemes []string `yaml:"allowed_schemes" env:"URL_ALLOWED_SCHEMES"`
+	MaxURLLength   int      `yaml:"max_url_length" env:"URL_MAX_LENGTH"`
+	// Other URL shorteners; links to them (or their subdomains) are handled
+	// according to ShortenerPolicy
+	Shorteners      []string      `yaml:"shorteners" env:"URL_SHORTENER_DOMAINS"`
+	ShortenerPolicy string        `yaml:"shortener_policy" env:"URL_SHORTENER_POLICY"`
+	UnwrapTimeout   time.Duration `yaml:"unwrap_timeout" env:"URL_UNWRAP_TIMEOUT"`
+}
+
+// Links to other shorteners are refused, or replaced by the destination
+// the shortener redirects to.
+const (
+	ShortenerReject = "reject"
+	ShortenerUnwrap = "unwrap"
+)
+
+// Blocklist names the destination domains links may not point to, on top
+// of those managed through the admin API.
+type Blocklist struct {
+	// One pattern per line, optionally followed by a reason
+	File string `yaml:"file" env:"BLOCKLIST_FILE"`
+	// How often the file and the stored entries are re-read
+	ReloadInterval time.Duration `yaml:"reload_interval" env:"BLOCKLIST_RELOAD_INTERVAL"`
+}
+
+type Admin struct {
+	// Bearer token of the /admin endpoints; empty disables them
+	Token string `yaml:"token" env:"ADMIN_TOKEN"`
+}
+
+// RateLimit sets per-client quotas, clients being told apart by API key or
+// else by IP. A zero limit disables the quota.
+type RateLimit struct {
+	ShortenLimit   int           `yaml:"shorten_limit" env:"RATE_LIMIT_SHORTEN"`
+	ShortenWindow  time.Duration `yaml:"shorten_window" env:"RATE_LIMIT_SHORTEN_WINDOW"`
+	RedirectLimit  int           `yaml:"redirect_limit" env:"RATE_LIMIT_REDIRECT"`
+	RedirectWindow time.Duration `yaml:"redirect_window" env:"RATE_LIMIT_REDIRECT_WINDOW"`
+	// Keys clients send in X-API-Key to get a quota of their own instead of
+	// sharing their IP's; unknown keys are ignored
+	APIKeys []string `yaml:"api_keys" env:"API_KEYS"`
+}
+
+// Passwords tunes access to password-protected links.
+type Passwords struct {
+	// Signs unlock cookies; set it to the same value on every replica
+	CookieSecret string `yaml:"cookie_secret" env:"LINK_COOKIE_SECRET"`
+	// How long a link stays unlocked after the right password
+	UnlockTTL time.Duration `yaml:"unlock_ttl" env:"LINK_UNLOCK_TTL"`
+	// Attempts per client and link; zero disables the limit
+	MaxAttempts   int           `yaml:"max_attempts" env:"LINK_UNLOCK_MAX_ATTEMPTS"`
+	AttemptWindow time.Duration `yaml:"attempt_window" env:"LINK_UNLOCK_ATTEMPT_WINDOW"`
+}
+
+type IDService struct {
+	Domain string `yaml:"domain" env:"ID_SERVICE_DOMAIN"`
+	Port   string `yaml:"port" env:"ID_SERVICE_PORT"`
+	// Bounds each call the API makes to the ID service
+	Timeout time.Duration `yaml:"timeout" env:"ID_SERVICE_TIMEOUT"`
+}
+
+// BaseURL is where the API reaches the ID service.
+func (s IDService) BaseURL() string {
+	return "http://" + s.Domain + s.Port
+}
+
+type Postgres struct {
+	URL string `yaml:"url" env:"DB_URL"`
+	// Read replicas; empty sends every query to URL
+	ReadURLs []string `yaml:"read_urls" env:"DB_READ_URLS"`
+	// Pool limits apply to the primary and to each replica
+	MaxOpenConns    int           `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME"`
+	// Server-side limit on every statement; zero disables it
+	StatementTimeout time.Duration `yaml:"statement_timeout" env:"DB_STATEMENT_TIMEOUT"`
+	LogLevel         string        `yaml:"log_level" env:"GORM_LOG_LEVEL"`
+}
+
+type SQLite struct {
+	Path string `yaml:"path" env:"SQLITE_PATH"`
+}
+
+type Redis struct {
+	Addr     string `yaml:"addr" env:"REDIS_ADDR"`
+	Password string `yaml:"password" env:"REDIS_PASSWORD"`
+	DB       int    `yaml:"db" env:"REDIS_DB"`
+	// Zero keeps the client default of 10 connections per CPU
+	PoolSize     int           `yaml:"pool_size" env:"REDIS_POOL_SIZE"`
+	MinIdleConns int           `yaml:"min_idle_conns" env:"REDIS_MIN_IDLE_CONNS"`
+	DialTimeout  time.Duration `yaml:"dial_timeout" env:"REDIS_DIAL_TIMEOUT"`
+	ReadTimeout  time.Duration `yaml:"read_timeout" env:"REDIS_READ_TIMEOUT"`
+	WriteTimeout time.Duration `yaml:"write_timeout" env:"REDIS_WRITE_TIMEOUT"`
+}
+
+type RabbitMQ struct {
+	URL        string `yaml:"url" env:"RABBITMQ_URL"`
+	ClickQueue string `yaml:"click_queue" env:"CLICK_QUEUE_NAME"`
+}
+
+// Cache tunes the API's redirect caches.
+type Cache struct {
+	LocalSize            int           `yaml:"local_size" env:"LOCAL_CACHE_SIZE"`
+	LocalTTL             time.Duration `yaml:"local_ttl" env:"LOCAL_CACHE_TTL"`
+	BreakerFailures      int           `yaml:"breaker_failures" env:"REDIS_BREAKER_FAILURES"`
+	BreakerCooldown      time.Duration `yaml:"breaker_cooldown" env:"REDIS_BREAKER_COOLDOWN"`
+	BloomEnabled         bool          `yaml:"bloom_enabled" env:"BLOOM_FILTER_ENABLED"`
+	BloomFalsePositive   float64       `yaml:"bloom_false_positive_rate" env:"BLOOM_FALSE_POSITIVE_RATE"`
+	BloomRebuildInterval time.Duration `yaml:"bloom_rebuild_interval" env:"BLOOM_REBUILD_INTERVAL"`
+	// Zero disables cache warming
+	WarmTopN     int           `yaml:"warm_top_n" env:"CACHE_WARM_TOP_N"`
+	WarmInterval time.Duration `yaml:"warm_interval" env:"CACHE_WARM_INTERVAL"`
+}
+
+type Analytics struct {
+	UniqueVisitorsRetentionDays int    `yaml:"unique_visitors_retention_days" env:"UNIQUE_VISITORS_RETENTION_DAYS"`
+	BotPatternsFile             string `yaml:"bot_patterns_file" env:"BOT_PATTERNS_FILE"`
+}
+
+// UniqueVisitorsRetention is how long per-day unique visitor data is kept.
+func (a Analytics) UniqueVisitorsRetention() time.Duration {
+	return time.Duration(a.UniqueVisitorsRetentionDays) * 24 * time.Hour
+}
+
+// Click counts go straight to url_analytics on every batch, or accumulate in
+// Redis and a flusher moves them periodically.
+const (
+	AggregatePostgres = "postgres"
+	AggregateRedis    = "redis"
+)
+
+type Worker struct {
+	Consumers          int           `yaml:"consumers" env:"WORKER_CONSUMERS"`
+	Prefetch           int           `yaml:"prefetch" env:"WORKER_PREFETCH"`
+	BatchSize          int           `yaml:"batch_size" env:"WORKER_BATCH_SIZE"`
+	FlushInterval      time.Duration `yaml:"flush_interval" env:"WORKER_FLUSH_INTERVAL"`
+	Aggregation        string        `yaml:"aggregation" env:"CLICK_AGGREGATION"`
+	RedisFlushInterval time.Duration `yaml:"redis_flush_interval" env:"CLICK_REDIS_FLUSH_INTERVAL"`
+	MetricsPort        string        `yaml:"metrics_port" env:"WORKER_METRICS_PORT"`
+}
+
+// Default returns the configuration used when nothing overrides it.
+func Default() *Config {
+	return &Config{
+		App: App{
+			Domain: "http://localhost:8080",
+			Port:   ":8080",
+		},
+		HTTP: HTTP{
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 10 * time.Second,
+			IdleTimeout:  60 * time.Second,
+			BodyLimit:    1 << 20,
+		},
+		Links: Links{
+			AllowedSchemes: []string{"http", "https"},
+			MaxURLLength:   2048,
+			Shorteners: []string{
+				"bit.ly", "buff.ly", "cutt.ly", "goo.gl", "is.gd", "ow.ly",
+				"rebrand.ly", "shorturl.at", "t.co", "t.ly", "tinyurl.com",
+			},
+			ShortenerPolicy: ShortenerReject,
+			UnwrapTimeout:   3 * time.Second,
+		},
+		Blocklist: Blocklist{
+			ReloadInterval: 30 * time.Second,
+		},
+		RateLimit: RateLimit{
+			ShortenLimit:   30,
+			ShortenWindow:  1 * time.Minute,
+			RedirectLimit:  300,
+			RedirectWindow: 1 * time.Minute,
+		},
+		Passwords: Passwords{
+			UnlockTTL:     15 * time.Minute,
+			MaxAttempts:   5,
+			AttemptWindow: 15 * time.Minute,
+		},
+		IDService: IDService{
+			Domain:  "localhost",
+			Port:    ":8081",
+			Timeout: 2 * time.Second,
+		},
+		Postgres: Postgres{
+			MaxOpenConns:     25,
+			MaxIdleConns:     10,
+			ConnMaxLifetime:  30 * time.Minute,
+			ConnMaxIdleTime:  5 * time.Minute,
+			StatementTimeout: 5 * time.Second,
+		},
+		SQLite: SQLite{
+			Path: "url-shortener.db",
+		},
+		Redis: Redis{
+			DialTimeout:  5 * time.Second,
+			ReadTimeout:  3 * time.Second,
+			WriteTimeout: 3 * time.Second,
+		},
+		Cache: Cache{
+			LocalSize:            10000,
+			LocalTTL:             1 * time.Minute,
+			BreakerFailures:      5,
+			BreakerCooldown:      10 * time.Second,
+			BloomEnabled:         true,
+			BloomFalsePositive:   0.01,
+			BloomRebuildInterval: 10 * time.Minute,
+			WarmTopN:             1000,
+			WarmInterval:         15 * time.Minute,
+		},
+		Analytics: Analytics{
+			UniqueVisitorsRetentionDays: 90,
+		},
+		Worker: Worker{
+			Consumers:          4,
+			Prefetch:           100,
+			BatchSize:          100,
+			FlushInterval:      2 * time.Second,
+			Aggregation:        AggregatePostgres,
+			RedisFlushInterval: 5 * time.Second,
+			MetricsPort:        ":9090",
+		},
+	}
+}
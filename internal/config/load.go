@@ -0,0 +1,222 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	schemeRe     = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*$`)
+	// Schemes that run code or read local files in the browser
+	unsafeSchemes = map[string]bool{"javascript": true, "vbscript": true, "data": true, "file": true}
+)
+
+// Load builds the configuration from the defaults, the CONFIG_FILE YAML file
+// and the environment, then validates it. Services pass the env variables
+// they can't run without as required. The error lists every problem found.
+func Load(required ...string) (*Config, error) {
+	cfg := Default()
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil {
+			return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+	}
+
+	var errs []error
+	walk(reflect.ValueOf(cfg).Elem(), "", func(f field) {
+		raw, ok := os.LookupEnv(f.env)
+		if !ok || strings.TrimSpace(raw) == "" {
+			return
+		}
+		if err := set(f.value, strings.TrimSpace(raw)); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", f.env, err))
+		}
+	})
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	errs = cfg.validate()
+	missing := make(map[string]bool, len(required))
+	for _, env := range required {
+		missing[env] = true
+	}
+	walk(reflect.ValueOf(cfg).Elem(), "", func(f field) {
+		if missing[f.env] {
+			delete(missing, f.env)
+			if f.value.IsZero() {
+				errs = append(errs, fmt.Errorf("%s (%s) is required", f.env, f.path))
+			}
+		}
+	})
+	for env := range missing {
+		errs = append(errs, fmt.Errorf("%s is not a configuration variable", env))
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return cfg, nil
+}
+
+type field struct {
+	env   string
+	path  string
+	value reflect.Value
+}
+
+// walk calls fn with every field carrying an env tag, path being its dotted
+// YAML key.
+func walk(v reflect.Value, prefix string, fn func(field)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		path := prefix + sf.Tag.Get("yaml")
+		if sf.Type.Kind() == reflect.Struct {
+			walk(v.Field(i), path+".", fn)
+			continue
+		}
+		if env := sf.Tag.Get("env"); env != "" {
+			fn(field{env: env, path: path, value: v.Field(i)})
+		}
+	}
+}
+
+func set(v reflect.Value, raw string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", raw)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		v.SetInt(int64(n))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", raw)
+		}
+		v.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		v.SetBool(b)
+	case reflect.Slice:
+		// Comma-separated list
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+func (c *Config) validate() []error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	appURL, err := url.Parse(c.App.Domain)
+	check(err == nil && (appURL.Scheme == "http" || appURL.Scheme == "https") && appURL.Host != "",
+		"APP_DOMAIN must be an http or https base URL, got %q", c.App.Domain)
+	check(c.HTTP.ReadTimeout >= 0, "HTTP_READ_TIMEOUT must not be negative")
+	check(c.HTTP.WriteTimeout >= 0, "HTTP_WRITE_TIMEOUT must not be negative")
+	check(c.HTTP.IdleTimeout >= 0, "HTTP_IDLE_TIMEOUT must not be negative")
+	check(c.HTTP.BodyLimit > 0, "HTTP_BODY_LIMIT must be positive, got %d", c.HTTP.BodyLimit)
+	// Trusting the header from anyone lets clients pick their own IP
+	check(c.HTTP.ProxyHeader == "" || len(c.HTTP.TrustedProxies) > 0, "HTTP_PROXY_HEADER requires HTTP_TRUSTED_PROXIES")
+	check(len(c.Links.AllowedSchemes) > 0, "URL_ALLOWED_SCHEMES must list at least one scheme")
+	for _, scheme := range c.Links.AllowedSchemes {
+		check(schemeRe.MatchString(scheme), "URL_ALLOWED_SCHEMES: invalid scheme %q", scheme)
+		check(!unsafeSchemes[strings.ToLower(scheme)], "URL_ALLOWED_SCHEMES: scheme %q can't be allowed", scheme)
+	}
+	check(c.Links.MaxURLLength > 0, "URL_MAX_LENGTH must be positive, got %d", c.Links.MaxURLLength)
+	check(c.Links.ShortenerPolicy == ShortenerReject || c.Links.ShortenerPolicy == ShortenerUnwrap,
+		"URL_SHORTENER_POLICY must be %s or %s, got %q", ShortenerReject, ShortenerUnwrap, c.Links.ShortenerPolicy)
+	check(c.Links.UnwrapTimeout > 0, "URL_UNWRAP_TIMEOUT must be positive, got %s", c.Links.UnwrapTimeout)
+	check(c.Blocklist.ReloadInterval > 0, "BLOCKLIST_RELOAD_INTERVAL must be positive, got %s", c.Blocklist.ReloadInterval)
+	check(c.RateLimit.ShortenLimit >= 0, "RATE_LIMIT_SHORTEN must not be negative, got %d", c.RateLimit.ShortenLimit)
+	check(c.RateLimit.ShortenWindow >= time.Second, "RATE_LIMIT_SHORTEN_WINDOW must be at least 1s, got %s", c.RateLimit.ShortenWindow)
+	check(c.RateLimit.RedirectLimit >= 0, "RATE_LIMIT_REDIRECT must not be negative, got %d", c.RateLimit.RedirectLimit)
+	check(c.RateLimit.RedirectWindow >= time.Second, "RATE_LIMIT_REDIRECT_WINDOW must be at least 1s, got %s", c.RateLimit.RedirectWindow)
+	check(c.Passwords.CookieSecret == "" || len(c.Passwords.CookieSecret) >= 32,
+		"LINK_COOKIE_SECRET must be at least 32 characters long")
+	check(c.Passwords.UnlockTTL > 0, "LINK_UNLOCK_TTL must be positive, got %s", c.Passwords.UnlockTTL)
+	check(c.Passwords.MaxAttempts >= 0, "LINK_UNLOCK_MAX_ATTEMPTS must not be negative, got %d", c.Passwords.MaxAttempts)
+	check(c.Passwords.AttemptWindow >= time.Second, "LINK_UNLOCK_ATTEMPT_WINDOW must be at least 1s, got %s", c.Passwords.AttemptWindow)
+	check(c.IDService.Timeout > 0, "ID_SERVICE_TIMEOUT must be positive, got %s", c.IDService.Timeout)
+
+	check(c.Postgres.MaxOpenConns > 0, "DB_MAX_OPEN_CONNS must be positive, got %d", c.Postgres.MaxOpenConns)
+	check(c.Postgres.MaxIdleConns >= 0 && c.Postgres.MaxIdleConns <= c.Postgres.MaxOpenConns,
+		"DB_MAX_IDLE_CONNS must be between 0 and DB_MAX_OPEN_CONNS (%d), got %d", c.Postgres.MaxOpenConns, c.Postgres.MaxIdleConns)
+	check(c.Postgres.ConnMaxLifetime >= 0, "DB_CONN_MAX_LIFETIME must not be negative")
+	check(c.Postgres.ConnMaxIdleTime >= 0, "DB_CONN_MAX_IDLE_TIME must not be negative")
+	check(c.Postgres.StatementTimeout >= 0, "DB_STATEMENT_TIMEOUT must not be negative")
+
+	check(c.Redis.DB >= 0, "REDIS_DB must not be negative, got %d", c.Redis.DB)
+	check(c.Redis.PoolSize >= 0, "REDIS_POOL_SIZE must not be negative, got %d", c.Redis.PoolSize)
+	check(c.Redis.MinIdleConns >= 0, "REDIS_MIN_IDLE_CONNS must not be negative, got %d", c.Redis.MinIdleConns)
+	check(c.Redis.DialTimeout > 0, "REDIS_DIAL_TIMEOUT must be positive, got %s", c.Redis.DialTimeout)
+	check(c.Redis.ReadTimeout > 0, "REDIS_READ_TIMEOUT must be positive, got %s", c.Redis.ReadTimeout)
+	check(c.Redis.WriteTimeout > 0, "REDIS_WRITE_TIMEOUT must be positive, got %s", c.Redis.WriteTimeout)
+
+	check(c.Cache.LocalSize > 0, "LOCAL_CACHE_SIZE must be positive, got %d", c.Cache.LocalSize)
+	check(c.Cache.LocalTTL > 0, "LOCAL_CACHE_TTL must be positive, got %s", c.Cache.LocalTTL)
+	check(c.Cache.BreakerFailures > 0, "REDIS_BREAKER_FAILURES must be positive, got %d", c.Cache.BreakerFailures)
+	check(c.Cache.BreakerCooldown > 0, "REDIS_BREAKER_COOLDOWN must be positive, got %s", c.Cache.BreakerCooldown)
+	check(c.Cache.BloomFalsePositive > 0 && c.Cache.BloomFalsePositive < 1,
+		"BLOOM_FALSE_POSITIVE_RATE must be between 0 and 1 exclusive, got %g", c.Cache.BloomFalsePositive)
+	check(c.Cache.BloomRebuildInterval > 0, "BLOOM_REBUILD_INTERVAL must be positive, got %s", c.Cache.BloomRebuildInterval)
+	check(c.Cache.WarmTopN >= 0, "CACHE_WARM_TOP_N must not be negative, got %d", c.Cache.WarmTopN)
+	check(c.Cache.WarmInterval > 0, "CACHE_WARM_INTERVAL must be positive, got %s", c.Cache.WarmInterval)
+
+	check(c.Analytics.UniqueVisitorsRetentionDays > 0,
+		"UNIQUE_VISITORS_RETENTION_DAYS must be positive, got %d", c.Analytics.UniqueVisitorsRetentionDays)
+
+	check(c.Worker.Consumers > 0, "WORKER_CONSUMERS must be positive, got %d", c.Worker.Consumers)
+	check(c.Worker.Prefetch > 0, "WORKER_PREFETCH must be positive, got %d", c.Worker.Prefetch)
+	check(c.Worker.BatchSize > 0, "WORKER_BATCH_SIZE must be positive, got %d", c.Worker.BatchSize)
+	check(c.Worker.FlushInterval > 0, "WORKER_FLUSH_INTERVAL must be positive, got %s", c.Worker.FlushInterval)
+	check(c.Worker.Aggregation == AggregatePostgres || c.Worker.Aggregation == AggregateRedis,
+		"CLICK_AGGREGATION must be %s or %s, got %q", AggregatePostgres, AggregateRedis, c.Worker.Aggregation)
+	check(c.Worker.RedisFlushInterval > 0, "CLICK_REDIS_FLUSH_INTERVAL must be positive, got %s", c.Worker.RedisFlushInterval)
+
+	return errs
+}
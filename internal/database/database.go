@@ -0,0 +1,98 @@
+// Package database opens the Postgres and Redis clients described by the
+// configuration, instrumented for tracing.
+package database
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/extra/redisotel/v9"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+
+	"github.com/MagnunAVF/url-shortener/internal/config"
+	applog "github.com/MagnunAVF/url-shortener/internal/logger"
+	"github.com/MagnunAVF/url-shortener/internal/tracing"
+)
+
+// OpenPostgres connects to the primary and registers the read replicas, if
+// any: lookups then go to the replicas while writes and transactions always
+// go to the primary.
+func OpenPostgres(cfg config.Postgres) (*gorm.DB, error) {
+	db, err := gorm.Open(postgres.Open(withStatementTimeout(cfg.URL, cfg)), &gorm.Config{Logger: applog.NewGormLogger(cfg.LogLevel)})
+	if err != nil {
+		return nil, err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+
+	if len(cfg.ReadURLs) > 0 {
+		replicas := make([]gorm.Dialector, 0, len(cfg.ReadURLs))
+		for _, readURL := range cfg.ReadURLs {
+			replicas = append(replicas, postgres.Open(withStatementTimeout(readURL, cfg)))
+		}
+		resolver := dbresolver.Register(dbresolver.Config{
+			Replicas: replicas,
+			Policy:   dbresolver.RandomPolicy{},
+		}).
+			SetMaxOpenConns(cfg.MaxOpenConns).
+			SetMaxIdleConns(cfg.MaxIdleConns).
+			SetConnMaxLifetime(cfg.ConnMaxLifetime).
+			SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+		if err := db.Use(resolver); err != nil {
+			return nil, fmt.Errorf("failed to configure read replicas: %w", err)
+		}
+	}
+
+	if err := db.Use(tracing.GormPlugin{}); err != nil {
+		return nil, fmt.Errorf("failed to instrument database: %w", err)
+	}
+	return db, nil
+}
+
+// withStatementTimeout sets statement_timeout as a session parameter of dsn,
+// in either URL or key=value form.
+func withStatementTimeout(dsn string, cfg config.Postgres) string {
+	if cfg.StatementTimeout <= 0 {
+		return dsn
+	}
+	ms := strconv.FormatInt(cfg.StatementTimeout.Milliseconds(), 10)
+	if strings.Contains(dsn, "://") {
+		if u, err := url.Parse(dsn); err == nil {
+			q := u.Query()
+			q.Set("statement_timeout", ms)
+			u.RawQuery = q.Encode()
+			return u.String()
+		}
+	}
+	return dsn + " statement_timeout=" + ms
+}
+
+// NewRedis builds the Redis client. It connects lazily: callers decide
+// whether a failed ping is fatal.
+func NewRedis(cfg config.Redis) (*redis.Client, error) {
+	rdb := redis.NewClient(&redis.Options{
+		Addr:         cfg.Addr,
+		Password:     cfg.Password,
+		DB:           cfg.DB,
+		PoolSize:     cfg.PoolSize,
+		MinIdleConns: cfg.MinIdleConns,
+		DialTimeout:  cfg.DialTimeout,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+	})
+	if err := redisotel.InstrumentTracing(rdb); err != nil {
+		return nil, fmt.Errorf("failed to instrument Redis: %w", err)
+	}
+	return rdb, nil
+}
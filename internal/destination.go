@@ -0,0 +1,213 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+var ErrInvalidURL = errors.New("invalid URL")
+
+// URLPolicy decides which destinations links may point to.
+type URLPolicy struct {
+	// Lowercase schemes; anything beyond http and https is meant for app
+	// deep links.
+	AllowedSchemes []string
+	MaxLength      int
+}
+
+// Normalize validates raw against the policy and returns its canonical
+// form, the one links are stored and deduplicated by: lowercase scheme and
+// host, IDN hosts in punycode, no default port, "/" for an empty path and
+// query parameters stably sorted by name. Errors wrap ErrInvalidURL and
+// read well as API error messages.
+func (p URLPolicy) Normalize(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if len(raw) > p.MaxLength {
+		return "", fmt.Errorf("%w: longer than %d characters", ErrInvalidURL, p.MaxLength)
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("%w: malformed", ErrInvalidURL)
+	}
+	if u.Scheme == "" {
+		return "", fmt.Errorf("%w: must be absolute, with a scheme", ErrInvalidURL)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if !p.allows(u.Scheme) {
+		return "", fmt.Errorf("%w: scheme %q is not allowed", ErrInvalidURL, u.Scheme)
+	}
+
+	if u.Scheme == "http" || u.Scheme == "https" {
+		if err := normalizeWebURL(u); err != nil {
+			return "", err
+		}
+	}
+	u.RawQuery = sortQuery(u.RawQuery)
+
+	normalized := u.String()
+	// Punycode can make the host longer than it was
+	if len(normalized) > p.MaxLength {
+		return "", fmt.Errorf("%w: longer than %d characters", ErrInvalidURL, p.MaxLength)
+	}
+	return normalized, nil
+}
+
+func (p URLPolicy) allows(scheme string) bool {
+	for _, s := range p.AllowedSchemes {
+		if s == scheme {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeWebURL(u *url.URL) error {
+	if u.Opaque != "" || u.Host == "" {
+		return fmt.Errorf("%w: missing host", ErrInvalidURL)
+	}
+	// user:password@host is mostly used to disguise the real destination
+	if u.User != nil {
+		return fmt.Errorf("%w: credentials are not allowed", ErrInvalidURL)
+	}
+
+	host := u.Hostname()
+	if ip := net.ParseIP(host); ip == nil {
+		ascii, err := idna.Lookup.ToASCII(host)
+		if err != nil {
+			return fmt.Errorf("%w: invalid host %q", ErrInvalidURL, host)
+		}
+		host = ascii
+	} else if ip.To4() == nil {
+		host = "[" + ip.String() + "]"
+	}
+	host = strings.ToLower(host)
+
+	port := u.Port()
+	if port != "" {
+		n, err := strconv.Atoi(port)
+		if err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("%w: invalid port %q", ErrInvalidURL, port)
+		}
+		if (u.Scheme == "http" && n == 80) || (u.Scheme == "https" && n == 443) {
+			port = ""
+		}
+	}
+	if port != "" {
+		host += ":" + port
+	}
+	u.Host = host
+
+	if u.Path == "" && u.RawPath == "" {
+		u.Path = "/"
+	}
+	return nil
+}
+
+// QueryMode decides what redirects do with the query string of the short
+// URL they were reached through.
+type QueryMode string
+
+const (
+	// QueryDrop ignores it
+	QueryDrop QueryMode = "drop"
+	// QueryMerge adds its parameters to the destination's, the
+	// destination's winning for names present in both
+	QueryMerge QueryMode = "merge"
+	// QueryOverride adds its parameters to the destination's, replacing
+	// every value the destination has for names present in both
+	QueryOverride QueryMode = "override"
+)
+
+// Valid reports whether m is one of the known modes.
+func (m QueryMode) Valid() bool {
+	return m == QueryDrop || m == QueryMerge || m == QueryOverride
+}
+
+// MergeQuery applies the incoming raw query string to destination according
+// to mode. Parameters are copied without re-encoding; names listed in skip
+// are never forwarded.
+func MergeQuery(destination, incoming string, mode QueryMode, skip ...string) string {
+	if incoming == "" || (mode != QueryMerge && mode != QueryOverride) {
+		return destination
+	}
+	u, err := url.Parse(destination)
+	if err != nil {
+		return destination
+	}
+
+	var params []string
+	if u.RawQuery != "" {
+		params = strings.Split(u.RawQuery, "&")
+	}
+	existing := make(map[string]bool, len(params))
+	for _, p := range params {
+		existing[queryName(p)] = true
+	}
+
+	var added []string
+	replaced := make(map[string]bool)
+	for _, p := range strings.Split(incoming, "&") {
+		name := queryName(p)
+		if p == "" || slices.Contains(skip, name) {
+			continue
+		}
+		if existing[name] {
+			if mode == QueryMerge {
+				continue
+			}
+			replaced[name] = true
+		}
+		added = append(added, p)
+	}
+	if len(added) == 0 {
+		return destination
+	}
+
+	kept := params[:0]
+	for _, p := range params {
+		if !replaced[queryName(p)] {
+			kept = append(kept, p)
+		}
+	}
+	u.RawQuery = strings.Join(append(kept, added...), "&")
+	return u.String()
+}
+
+// queryName returns the decoded name of a raw name=value parameter.
+func queryName(param string) string {
+	name, _, _ := strings.Cut(param, "=")
+	if decoded, err := url.QueryUnescape(name); err == nil {
+		return decoded
+	}
+	return name
+}
+
+// sortQuery orders parameters by name, keeping repeated names in their
+// original order, without re-encoding them.
+func sortQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	params := strings.Split(rawQuery, "&")
+	kept := params[:0]
+	for _, param := range params {
+		if param != "" {
+			kept = append(kept, param)
+		}
+	}
+	sort.SliceStable(kept, func(i, j int) bool {
+		ki, _, _ := strings.Cut(kept[i], "=")
+		kj, _, _ := strings.Cut(kept[j], "=")
+		return ki < kj
+	})
+	return strings.Join(kept, "&")
+}
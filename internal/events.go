@@ -0,0 +1,28 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrPublisherClosed = errors.New("event publisher closed")
+
+// ClickEvent is published for every redirect and consumed by the analytics
+// worker.
+type ClickEvent struct {
+	ShortCode string    `json:"short_code"`
+	Timestamp time.Time `json:"timestamp"`
+	UserAgent string    `json:"user_agent"`
+	Method    string    `json:"method"`
+	Accept    string    `json:"accept"`
+	Purpose   string    `json:"purpose,omitempty"`
+	VisitorID string    `json:"visitor_id,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+}
+
+// EventPublisher hands click events over to the analytics pipeline.
+type EventPublisher interface {
+	PublishClick(ctx context.Context, event ClickEvent) error
+	Ping(ctx context.Context) error
+}
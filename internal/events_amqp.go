@@ -0,0 +1,63 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/rabbitmq/amqp091-go"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/MagnunAVF/url-shortener/internal/tracing"
+)
+
+// AMQPPublisher publishes click events as JSON to a RabbitMQ queue, carrying
+// the trace context in message headers.
+type AMQPPublisher struct {
+	ch    *amqp091.Channel
+	queue string
+}
+
+func NewAMQPPublisher(ch *amqp091.Channel, queue string) *AMQPPublisher {
+	return &AMQPPublisher{ch: ch, queue: queue}
+}
+
+func (p *AMQPPublisher) PublishClick(ctx context.Context, event ClickEvent) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, p.queue+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemRabbitMQ,
+			semconv.MessagingOperationTypeSend,
+			semconv.MessagingDestinationName(p.queue),
+		),
+	)
+	defer func() {
+		if err != nil {
+			tracing.Fail(span, err)
+		}
+		span.End()
+	}()
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal click event: %w", err)
+	}
+	return p.ch.PublishWithContext(
+		ctx,
+		"", p.queue, false, false,
+		amqp091.Publishing{
+			ContentType: "application/json",
+			Headers:     tracing.InjectAMQP(ctx, nil),
+			Body:        body,
+		},
+	)
+}
+
+// Ping fails once the channel has been closed by the broker or the connection.
+func (p *AMQPPublisher) Ping(ctx context.Context) error {
+	if p.ch.IsClosed() {
+		return ErrPublisherClosed
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package internal
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrPublisherFull = errors.New("event publisher buffer full")
+
+// ChannelPublisher hands click events to an in-process consumer through a
+// buffered channel. Publishing never blocks: events are dropped with
+// ErrPublisherFull when the consumer falls behind.
+type ChannelPublisher struct {
+	events chan ClickEvent
+}
+
+func NewChannelPublisher(size int) *ChannelPublisher {
+	return &ChannelPublisher{events: make(chan ClickEvent, size)}
+}
+
+func (p *ChannelPublisher) PublishClick(ctx context.Context, event ClickEvent) error {
+	select {
+	case p.events <- event:
+		return nil
+	default:
+		return ErrPublisherFull
+	}
+}
+
+func (p *ChannelPublisher) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Events is the consumer side of the publisher.
+func (p *ChannelPublisher) Events() <-chan ClickEvent {
+	return p.events
+}
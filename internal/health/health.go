@@ -0,0 +1,129 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const defaultTimeout = 2 * time.Second
+
+// Check reports whether a dependency is usable; nil means healthy.
+type Check func(ctx context.Context) error
+
+// Checker runs named readiness checks concurrently, each with a timeout.
+// Liveness never runs checks: a process that can answer is alive, and a
+// dependency outage must not get every replica restarted.
+type Checker struct {
+	timeout  time.Duration
+	names    []string
+	checks   map[string]Check
+	optional map[string]bool
+}
+
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+func NewChecker() *Checker {
+	return &Checker{
+		timeout:  defaultTimeout,
+		checks:   make(map[string]Check),
+		optional: make(map[string]bool),
+	}
+}
+
+// Add registers check under name, replacing any previous one.
+func (c *Checker) Add(name string, check Check) {
+	if _, ok := c.checks[name]; !ok {
+		c.names = append(c.names, name)
+	}
+	c.checks[name] = check
+	delete(c.optional, name)
+}
+
+// AddOptional registers a check for a dependency the service can run
+// without. Its failure is reported as "degraded" but keeps the service ready.
+func (c *Checker) AddOptional(name string, check Check) {
+	c.Add(name, check)
+	c.optional[name] = true
+}
+
+// Run executes every check and reports whether all of them passed.
+func (c *Checker) Run(ctx context.Context) (bool, Report) {
+	results := make([]error, len(c.names))
+	var wg sync.WaitGroup
+	for i, name := range c.names {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, c.timeout)
+			defer cancel()
+			results[i] = check(ctx)
+		}(i, c.checks[name])
+	}
+	wg.Wait()
+
+	ok, degraded := true, false
+	report := Report{Status: "ok", Checks: make(map[string]string, len(c.names))}
+	for i, name := range c.names {
+		switch {
+		case results[i] == nil:
+			report.Checks[name] = "ok"
+		case c.optional[name]:
+			degraded = true
+			report.Checks[name] = "degraded: " + results[i].Error()
+		default:
+			ok = false
+			report.Checks[name] = results[i].Error()
+		}
+	}
+	if !ok {
+		report.Status = "unavailable"
+	} else if degraded {
+		report.Status = "degraded"
+	}
+	return ok, report
+}
+
+// Register mounts /livez and /readyz on app. Call it before catch-all
+// routes such as /:short_code.
+func (c *Checker) Register(app *fiber.App) {
+	app.Get("/livez", func(ctx *fiber.Ctx) error {
+		return ctx.JSON(Report{Status: "ok"})
+	})
+	app.Get("/readyz", func(ctx *fiber.Ctx) error {
+		ok, report := c.Run(ctx.UserContext())
+		if !ok {
+			return ctx.Status(fiber.StatusServiceUnavailable).JSON(report)
+		}
+		return ctx.JSON(report)
+	})
+}
+
+// RegisterHTTP mounts /livez and /readyz on a net/http mux, for services
+// without a Fiber app.
+func (c *Checker) RegisterHTTP(mux *http.ServeMux) {
+	mux.HandleFunc("/livez", func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, http.StatusOK, Report{Status: "ok"})
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		ok, report := c.Run(r.Context())
+		status := http.StatusOK
+		if !ok {
+			status = http.StatusServiceUnavailable
+		}
+		writeReport(w, status, report)
+	})
+}
+
+func writeReport(w http.ResponseWriter, status int, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,104 @@
+// Package idgen is a simplified "Snowflake" ID generator.
+// It creates unique 64-bit IDs that are roughly time-sortable.
+// https://en.wikipedia.org/wiki/Snowflake_ID
+// This solves the "auto-increment" bottleneck in DB.
+package idgen
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	customEpoch int64 = 1704067200000 // Jan 1, 2024
+	nodeIDBits  uint  = 10
+	seqBits     uint  = 12
+	maxNodeID   int64 = -1 ^ (-1 << nodeIDBits)
+	maxSeq      int64 = -1 ^ (-1 << seqBits)
+)
+
+var ErrInvalidNodeID = fmt.Errorf("node ID must be between 0 and %d", maxNodeID)
+
+var (
+	idsGenerated = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "id_generated_total",
+		Help: "IDs handed out by the generator.",
+	})
+
+	idClockWaits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "id_clock_waits_total",
+		Help: "Times the generator had to wait for the next millisecond, by reason.",
+	}, []string{"reason"})
+
+	idClockWaitDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "id_clock_wait_duration_seconds",
+		Help:    "Time spent waiting for the clock to move forward.",
+		Buckets: []float64{.0005, .001, .002, .005, .01, .05, .1, .5, 1},
+	})
+)
+
+type Generator struct {
+	mu        sync.Mutex
+	lastStamp int64
+	nodeID    int64
+	seq       int64
+}
+
+// New returns a generator for nodeID, which must be unique among the
+// generators handing out IDs for the same storage.
+func New(nodeID int64) (*Generator, error) {
+	if nodeID < 0 || nodeID > maxNodeID {
+		return nil, ErrInvalidNodeID
+	}
+
+	return &Generator{nodeID: nodeID}, nil
+}
+
+func (g *Generator) NextID() (uint64, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ts := time.Now().UnixMilli()
+	if ts < g.lastStamp {
+		// Clock went backwards, wait
+		idClockWaits.WithLabelValues("clock_backwards").Inc()
+		ts = g.wait(ts)
+	}
+	if ts == g.lastStamp {
+		g.seq = (g.seq + 1) & maxSeq
+		if g.seq == 0 {
+			idClockWaits.WithLabelValues("sequence_exhausted").Inc()
+			ts = g.wait(ts)
+		}
+	} else {
+		g.seq = 0
+	}
+	g.lastStamp = ts
+	id := (uint64(ts-customEpoch) << (nodeIDBits + seqBits)) |
+		(uint64(g.nodeID) << seqBits) |
+		uint64(g.seq)
+
+	idsGenerated.Inc()
+	return id, nil
+}
+
+// Time returns when id was generated, to the millisecond.
+func Time(id uint64) time.Time {
+	return time.UnixMilli(int64(id>>(nodeIDBits+seqBits)) + customEpoch)
+}
+
+func (g *Generator) wait(currentTS int64) int64 {
+	start := time.Now()
+	defer func() { idClockWaitDuration.Observe(time.Since(start).Seconds()) }()
+
+	for currentTS <= g.lastStamp {
+		time.Sleep(1 * time.Millisecond)
+		currentTS = time.Now().UnixMilli()
+	}
+
+	return currentTS
+}
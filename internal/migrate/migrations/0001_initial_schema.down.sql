@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS url_analytics;
+DROP TABLE IF EXISTS urls;
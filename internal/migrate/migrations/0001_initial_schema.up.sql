@@ -0,0 +1,16 @@
+-- Matches the schema GORM AutoMigrate created, so existing databases adopt
+-- versioned migrations without changes.
+CREATE TABLE IF NOT EXISTS urls (
+    id bigint PRIMARY KEY,
+    short_code varchar(12) NOT NULL,
+    long_url text NOT NULL,
+    created_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_urls_short_code ON urls (short_code);
+CREATE INDEX IF NOT EXISTS idx_urls_long_url ON urls (long_url);
+
+CREATE TABLE IF NOT EXISTS url_analytics (
+    short_code varchar(12) PRIMARY KEY,
+    click_count bigint NOT NULL DEFAULT 0,
+    CONSTRAINT fk_urls_analytics FOREIGN KEY (short_code) REFERENCES urls (short_code) ON DELETE CASCADE
+);
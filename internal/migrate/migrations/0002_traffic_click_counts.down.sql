@@ -0,0 +1,3 @@
+ALTER TABLE url_analytics
+    DROP COLUMN IF EXISTS bot_click_count,
+    DROP COLUMN IF EXISTS human_click_count;
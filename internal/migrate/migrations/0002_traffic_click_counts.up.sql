@@ -0,0 +1,3 @@
+ALTER TABLE url_analytics
+    ADD COLUMN IF NOT EXISTS human_click_count bigint NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS bot_click_count bigint NOT NULL DEFAULT 0;
@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS blocked_domains (
+    pattern varchar(253) PRIMARY KEY,
+    reason text NOT NULL DEFAULT '',
+    created_at timestamptz NOT NULL DEFAULT now()
+);
@@ -0,0 +1,3 @@
+ALTER TABLE urls
+    DROP COLUMN IF EXISTS query_mode,
+    DROP COLUMN IF EXISTS redirect_status;
@@ -0,0 +1,3 @@
+ALTER TABLE urls
+    ADD COLUMN IF NOT EXISTS redirect_status smallint NOT NULL DEFAULT 302,
+    ADD COLUMN IF NOT EXISTS query_mode varchar(16) NOT NULL DEFAULT 'drop';
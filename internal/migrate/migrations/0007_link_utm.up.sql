@@ -0,0 +1,6 @@
+ALTER TABLE urls
+    ADD COLUMN IF NOT EXISTS utm_source varchar(200) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS utm_medium varchar(200) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS utm_campaign varchar(200) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS utm_term varchar(200) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS utm_content varchar(200) NOT NULL DEFAULT '';
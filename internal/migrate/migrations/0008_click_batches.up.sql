@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS click_batches (
+    batch_id varchar(32) PRIMARY KEY,
+    applied_at timestamptz NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_click_batches_applied_at ON click_batches (applied_at);
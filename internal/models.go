@@ -8,11 +8,29 @@ type URL struct {
 	ID        int64  `gorm:"primaryKey;type:bigint"`
 	ShortCode string `gorm:"type:varchar(12);uniqueIndex;not null"`
 	LongURL   string `gorm:"type:text;index;not null"`
+	// bcrypt hash, empty when the link isn't password protected
+	PasswordHash string `gorm:"type:text;not null;default:''"`
+	// Redirects show the preview page first, for links flagged as risky
+	Interstitial bool `gorm:"not null;default:false"`
+	// 301, 302, 307 or 308
+	RedirectStatus int `gorm:"type:smallint;not null;default:302"`
+	// What happens to the short URL's query string, see QueryMode
+	QueryMode QueryMode `gorm:"type:varchar(16);not null;default:'drop'"`
+	UTM       UTM       `gorm:"embedded;embeddedPrefix:utm_"`
 	CreatedAt time.Time
 	Analytics URLAnalytics `gorm:"foreignKey:ShortCode;references:ShortCode;constraint:OnDelete:CASCADE"`
 }
 
+// ClickBatch records a batch of click counts already added to
+// url_analytics, see LinkStore.ApplyClickBatch.
+type ClickBatch struct {
+	BatchID   string    `gorm:"primaryKey;type:varchar(32)"`
+	AppliedAt time.Time `gorm:"not null;index"`
+}
+
 type URLAnalytics struct {
-	ShortCode  string `gorm:"primaryKey;type:varchar(12)"`
-	ClickCount int64  `gorm:"default:0;not null"`
+	ShortCode       string `gorm:"primaryKey;type:varchar(12)"`
+	ClickCount      int64  `gorm:"default:0;not null"`
+	HumanClickCount int64  `gorm:"default:0;not null"`
+	BotClickCount   int64  `gorm:"default:0;not null"`
 }
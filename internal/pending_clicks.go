@@ -0,0 +1,83 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// When the analytics worker aggregates in Redis, click deltas accumulate in
+// the PendingClicksKey hash (one field per short code and traffic class)
+// until the flusher renames it to FlushingClicksKey and moves its content to
+// url_analytics. A leftover flushing hash means the last flush didn't finish
+// and is retried before a new snapshot is taken. The snapshot's
+// ClickBatchField holds its batch ID, which LinkStore.ApplyClickBatch
+// records so that retries never count it twice.
+const (
+	PendingClicksKey  = "clicks:pending"
+	FlushingClicksKey = "clicks:flushing"
+	ClickBatchField   = "batch"
+)
+
+// PendingClicks are the click deltas of a short code not persisted to
+// url_analytics yet, unless LinkStore.Analytics reports Batch applied: the
+// flushing snapshot stays in the cache for a moment after being persisted.
+type PendingClicks struct {
+	Pending  URLAnalytics
+	Flushing URLAnalytics
+	// Empty when no flush is in progress
+	Batch string
+}
+
+// PendingClickField is the hash field holding deltas of shortCode for class.
+func PendingClickField(shortCode string, class TrafficClass) string {
+	return shortCode + ":" + string(class)
+}
+
+// PendingClicks returns the click deltas of shortCode still pending and
+// being flushed.
+func (c *RedisCache) PendingClicks(ctx context.Context, shortCode string) (PendingClicks, error) {
+	fields := []string{
+		PendingClickField(shortCode, TrafficHuman),
+		PendingClickField(shortCode, TrafficBot),
+	}
+
+	// MULTI, so a snapshot taken in between can't show up in both hashes
+	pipe := c.rdb.TxPipeline()
+	pending := pipe.HMGet(ctx, PendingClicksKey, fields...)
+	flushing := pipe.HMGet(ctx, FlushingClicksKey, append(fields, ClickBatchField)...)
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return PendingClicks{}, err
+	}
+
+	clicks := PendingClicks{
+		Pending:  parseDeltas(shortCode, pending.Val()),
+		Flushing: parseDeltas(shortCode, flushing.Val()),
+	}
+	if vals := flushing.Val(); len(vals) == len(fields)+1 {
+		clicks.Batch, _ = vals[len(fields)].(string)
+	}
+	return clicks, nil
+}
+
+// parseDeltas reads the human and bot deltas of shortCode, in that order.
+func parseDeltas(shortCode string, vals []interface{}) URLAnalytics {
+	delta := URLAnalytics{ShortCode: shortCode}
+	if len(vals) >= 2 {
+		delta.HumanClickCount = parseCount(vals[0])
+		delta.BotClickCount = parseCount(vals[1])
+	}
+	delta.ClickCount = delta.HumanClickCount + delta.BotClickCount
+	return delta
+}
+
+func parseCount(v interface{}) int64 {
+	s, ok := v.(string)
+	if !ok {
+		return 0
+	}
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return n
+}
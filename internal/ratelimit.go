@@ -0,0 +1,140 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RateLimit allows Limit requests per Window. A zero Limit disables it.
+type RateLimit struct {
+	Limit  int
+	Window time.Duration
+}
+
+// RateLimitResult is the outcome of counting one request.
+type RateLimitResult struct {
+	Allowed   bool
+	Remaining int
+	// Time until the current window ends and its requests start sliding out
+	Reset time.Duration
+}
+
+// RateLimiter counts requests per key in a sliding window.
+type RateLimiter interface {
+	// Allow counts a request for key unless it would exceed limit.
+	Allow(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error)
+}
+
+// Both implementations approximate the sliding window from two fixed
+// windows: the previous window's count weighs in proportionally to how much
+// of it still overlaps the sliding one. That takes two counters per key
+// instead of one entry per request.
+
+// slidingWindow returns the start of the fixed window now falls in and the
+// weight of the previous window.
+func slidingWindow(now time.Time, window time.Duration) (start int64, prevWeight float64) {
+	ms := now.UnixMilli()
+	size := window.Milliseconds()
+	start = ms - ms%size
+	return start, 1 - float64(ms-start)/float64(size)
+}
+
+func rateLimitResult(allowed bool, estimate float64, limit RateLimit, start int64, now time.Time) RateLimitResult {
+	return RateLimitResult{
+		Allowed:   allowed,
+		Remaining: max(0, limit.Limit-int(math.Ceil(estimate))),
+		Reset:     time.UnixMilli(start).Add(limit.Window).Sub(now),
+	}
+}
+
+// Rejected requests aren't counted, so clients retrying in a loop don't
+// lock themselves out for longer.
+var slidingWindowScript = redis.NewScript(`
+local curr = tonumber(redis.call('GET', KEYS[1]) or '0')
+local prev = tonumber(redis.call('GET', KEYS[2]) or '0')
+local limit = tonumber(ARGV[1])
+local weight = tonumber(ARGV[2])
+if prev * weight + curr + 1 > limit then
+	return {0, tostring(prev * weight + curr)}
+end
+curr = redis.call('INCR', KEYS[1])
+if curr == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[3])
+end
+return {1, tostring(prev * weight + curr)}
+`)
+
+// Allow implements RateLimiter with one counter key per fixed window,
+// expiring once it can't weigh in anymore.
+func (c *RedisCache) Allow(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error) {
+	now := time.Now()
+	start, weight := slidingWindow(now, limit.Window)
+	size := limit.Window.Milliseconds()
+	// The hash tag keeps both windows on the same cluster slot
+	keys := []string{
+		fmt.Sprintf("ratelimit:{%s}:%d", key, start),
+		fmt.Sprintf("ratelimit:{%s}:%d", key, start-size),
+	}
+	res, err := slidingWindowScript.Run(ctx, c.rdb, keys, limit.Limit, weight, 2*size).Slice()
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	if len(res) != 2 {
+		return RateLimitResult{}, fmt.Errorf("unexpected rate limit script reply %v", res)
+	}
+	allowed, _ := res[0].(int64)
+	s, _ := res[1].(string)
+	estimate, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return RateLimitResult{}, fmt.Errorf("unexpected rate limit script reply %v", res)
+	}
+	return rateLimitResult(allowed == 1, estimate, limit, start, now), nil
+}
+
+type rateCounter struct {
+	start      int64
+	window     time.Duration
+	curr, prev int
+}
+
+// expired reports whether the counter can't weigh in anymore at now.
+func (rc *rateCounter) expired(now time.Time) bool {
+	return now.After(time.UnixMilli(rc.start).Add(2 * rc.window))
+}
+
+// Allow implements RateLimiter in process memory.
+func (c *MemoryCache) Allow(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error) {
+	return c.allow(key, limit, time.Now()), nil
+}
+
+func (c *MemoryCache) allow(key string, limit RateLimit, now time.Time) RateLimitResult {
+	start, weight := slidingWindow(now, limit.Window)
+	size := limit.Window.Milliseconds()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sweep()
+	rc, ok := c.rates[key]
+	switch {
+	case !ok:
+		rc = &rateCounter{start: start}
+		c.rates[key] = rc
+	case rc.start == start-size:
+		rc.start, rc.prev, rc.curr = start, rc.curr, 0
+	case rc.start != start:
+		rc.start, rc.prev, rc.curr = start, 0, 0
+	}
+	rc.window = limit.Window
+
+	estimate := float64(rc.prev)*weight + float64(rc.curr)
+	if estimate+1 > float64(limit.Limit) {
+		return rateLimitResult(false, estimate, limit, start, now)
+	}
+	rc.curr++
+	return rateLimitResult(true, estimate+1, limit, start, now)
+}
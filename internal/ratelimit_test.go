@@ -0,0 +1,58 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryCacheAllow(t *testing.T) {
+	limit := RateLimit{Limit: 4, Window: time.Minute}
+	// Start of a fixed window
+	t0 := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	steps := []struct {
+		name          string
+		at            time.Duration
+		wantAllowed   bool
+		wantRemaining int
+		wantReset     time.Duration
+	}{
+		{"first", 0, true, 3, time.Minute},
+		{"second", 10 * time.Second, true, 2, 50 * time.Second},
+		{"third", 10 * time.Second, true, 1, 50 * time.Second},
+		{"fourth", 20 * time.Second, true, 0, 40 * time.Second},
+		{"over limit", 30 * time.Second, false, 0, 30 * time.Second},
+		// The previous window weighs 3/4: 4*0.75 = 3 requests still count
+		{"quarter into next window", 75 * time.Second, true, 0, 45 * time.Second},
+		{"over limit in next window", 80 * time.Second, false, 0, 40 * time.Second},
+		// Now it weighs 1/4: 1 + the 1 made in this window
+		{"three quarters into next window", 105 * time.Second, true, 1, 15 * time.Second},
+		{"last of next window", 105 * time.Second, true, 0, 15 * time.Second},
+		{"over limit again", 110 * time.Second, false, 0, 10 * time.Second},
+		// Two windows later nothing weighs in anymore
+		{"window after next", 3 * time.Minute, true, 3, time.Minute},
+	}
+	c := NewMemoryCache()
+	for _, step := range steps {
+		res := c.allow("client", limit, t0.Add(step.at))
+		want := RateLimitResult{Allowed: step.wantAllowed, Remaining: step.wantRemaining, Reset: step.wantReset}
+		if res != want {
+			t.Fatalf("%s: Allow = %+v, want %+v", step.name, res, want)
+		}
+	}
+}
+
+func TestMemoryCacheAllowKeys(t *testing.T) {
+	limit := RateLimit{Limit: 1, Window: time.Minute}
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	c := NewMemoryCache()
+	if !c.allow("a", limit, now).Allowed {
+		t.Fatal("first request of a rejected")
+	}
+	if c.allow("a", limit, now).Allowed {
+		t.Error("second request of a allowed")
+	}
+	if !c.allow("b", limit, now).Allowed {
+		t.Error("first request of b rejected")
+	}
+}
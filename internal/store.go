@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrLinkNotFound = errors.New("link not found")
+
+// How long applied click batches are remembered; longer than a snapshot can
+// wait for its flush to be retried.
+const clickBatchRetention = 7 * 24 * time.Hour
+
+// LinkClicks is a link with its persisted total click count.
+type LinkClicks struct {
+	ShortCode string
+	LongURL   string
+	// bcrypt hash, empty when the link isn't password protected
+	PasswordHash   string
+	Interstitial   bool
+	RedirectStatus int
+	QueryMode      QueryMode
+	UTM            UTM `gorm:"embedded;embeddedPrefix:utm_"`
+	CreatedAt      time.Time
+	ClickCount     int64
+}
+
+// LinkUpdate lists the link attributes to change; nil fields are left
+// alone.
+type LinkUpdate struct {
+	Interstitial *bool
+	// Replaces every UTM field
+	UTM *UTM
+}
+
+// LinkStore is the durable storage of links and their click counts.
+// Lookups of a single link return ErrLinkNotFound when there is none.
+type LinkStore interface {
+	// FindByCode returns the link stored under shortCode.
+	FindByCode(ctx context.Context, shortCode string) (LinkClicks, error)
+	// FindDuplicate returns an unprotected link already pointing to
+	// url.LongURL with the same redirect behavior as url, which a new link
+	// can reuse.
+	FindDuplicate(ctx context.Context, url URL) (URL, error)
+	Create(ctx context.Context, url *URL) error
+	// UpdateLink changes the attributes of shortCode set in upd and returns
+	// the link as written, never as a lagging replica still has it.
+	UpdateLink(ctx context.Context, shortCode string, upd LinkUpdate) (LinkClicks, error)
+	// Analytics returns the persisted click counts of shortCode, zero when
+	// it was never clicked, and whether they include click batch batch
+	// (never when batch is empty). Both are read at once, so they agree
+	// even while the batch is being applied.
+	Analytics(ctx context.Context, shortCode, batch string) (URLAnalytics, bool, error)
+	// AddClicks increments the click counts of every record's short code by
+	// the record's counts.
+	AddClicks(ctx context.Context, recs []URLAnalytics) error
+	// ApplyClickBatch runs AddClicks and records batch atomically. A batch
+	// recorded before is skipped, reporting false, which makes retried
+	// flushes safe.
+	ApplyClickBatch(ctx context.Context, batch string, recs []URLAnalytics) (bool, error)
+	// ClicksByUTM sums the persisted clicks of links by their value of the
+	// UTM dimension (a UTMDimensions key), most clicked first, up to n
+	// values. Only links matching every non-empty field of filter count.
+	ClicksByUTM(ctx context.Context, dimension string, filter UTM, n int) ([]UTMClicks, error)
+	// TopClicked returns the n most clicked links, most clicked first.
+	TopClicked(ctx context.Context, n int) ([]LinkClicks, error)
+	Count(ctx context.Context) (int64, error)
+	// ScanShortCodes calls fn with every stored short code, batchSize at a
+	// time.
+	ScanShortCodes(ctx context.Context, batchSize int, fn func(codes []string)) error
+	Ping(ctx context.Context) error
+}
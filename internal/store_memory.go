@@ -0,0 +1,238 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+var ErrDuplicateLink = errors.New("duplicate link")
+
+// MemoryLinkStore keeps links in process memory. Nothing survives a
+// restart; it backs tests and single-process setups.
+type MemoryLinkStore struct {
+	mu        sync.RWMutex
+	links     map[string]URL
+	analytics map[string]URLAnalytics
+	batches   map[string]time.Time
+}
+
+func NewMemoryLinkStore() *MemoryLinkStore {
+	return &MemoryLinkStore{
+		links:     make(map[string]URL),
+		analytics: make(map[string]URLAnalytics),
+		batches:   make(map[string]time.Time),
+	}
+}
+
+func (s *MemoryLinkStore) FindByCode(ctx context.Context, shortCode string) (LinkClicks, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	url, ok := s.links[shortCode]
+	if !ok {
+		return LinkClicks{}, ErrLinkNotFound
+	}
+	return s.linkClicks(url), nil
+}
+
+// linkClicks adds the click count to url. Callers hold s.mu.
+func (s *MemoryLinkStore) linkClicks(url URL) LinkClicks {
+	return LinkClicks{
+		ShortCode:      url.ShortCode,
+		LongURL:        url.LongURL,
+		PasswordHash:   url.PasswordHash,
+		Interstitial:   url.Interstitial,
+		RedirectStatus: url.RedirectStatus,
+		QueryMode:      url.QueryMode,
+		UTM:            url.UTM,
+		CreatedAt:      url.CreatedAt,
+		ClickCount:     s.analytics[url.ShortCode].ClickCount,
+	}
+}
+
+func (s *MemoryLinkStore) FindDuplicate(ctx context.Context, want URL) (URL, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, url := range s.links {
+		if url.LongURL == want.LongURL && url.PasswordHash == "" && url.Interstitial == want.Interstitial &&
+			url.RedirectStatus == want.RedirectStatus && url.QueryMode == want.QueryMode && url.UTM == want.UTM {
+			return url, nil
+		}
+	}
+	return URL{}, ErrLinkNotFound
+}
+
+func (s *MemoryLinkStore) Create(ctx context.Context, url *URL) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.links[url.ShortCode]; ok {
+		return ErrDuplicateLink
+	}
+	if url.CreatedAt.IsZero() {
+		url.CreatedAt = time.Now()
+	}
+	s.links[url.ShortCode] = *url
+	return nil
+}
+
+func (s *MemoryLinkStore) UpdateLink(ctx context.Context, shortCode string, upd LinkUpdate) (LinkClicks, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	url, ok := s.links[shortCode]
+	if !ok {
+		return LinkClicks{}, ErrLinkNotFound
+	}
+	if upd.Interstitial != nil {
+		url.Interstitial = *upd.Interstitial
+	}
+	if upd.UTM != nil {
+		url.UTM = *upd.UTM
+	}
+	s.links[shortCode] = url
+	return s.linkClicks(url), nil
+}
+
+func (s *MemoryLinkStore) Analytics(ctx context.Context, shortCode, batch string) (URLAnalytics, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	analytics, ok := s.analytics[shortCode]
+	if !ok {
+		analytics.ShortCode = shortCode
+	}
+	_, applied := s.batches[batch]
+	return analytics, applied && batch != "", nil
+}
+
+func (s *MemoryLinkStore) AddClicks(ctx context.Context, recs []URLAnalytics) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.addClicks(recs)
+	return nil
+}
+
+func (s *MemoryLinkStore) ApplyClickBatch(ctx context.Context, batch string, recs []URLAnalytics) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.batches[batch]; ok {
+		return false, nil
+	}
+	s.addClicks(recs)
+	now := time.Now()
+	s.batches[batch] = now
+	for id, appliedAt := range s.batches {
+		if now.Sub(appliedAt) > clickBatchRetention {
+			delete(s.batches, id)
+		}
+	}
+	return true, nil
+}
+
+// addClicks is AddClicks for callers holding s.mu.
+func (s *MemoryLinkStore) addClicks(recs []URLAnalytics) {
+	for _, delta := range recs {
+		analytics := s.analytics[delta.ShortCode]
+		analytics.ShortCode = delta.ShortCode
+		analytics.ClickCount += delta.ClickCount
+		analytics.HumanClickCount += delta.HumanClickCount
+		analytics.BotClickCount += delta.BotClickCount
+		s.analytics[delta.ShortCode] = analytics
+	}
+}
+
+func (s *MemoryLinkStore) ClicksByUTM(ctx context.Context, dimension string, filter UTM, n int) ([]UTMClicks, error) {
+	if _, ok := UTMDimensions[dimension]; !ok {
+		return nil, ErrInvalidUTM
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	byValue := make(map[string]*UTMClicks)
+links:
+	for code, url := range s.links {
+		for d := range UTMDimensions {
+			if v := filter.Get(d); v != "" && url.UTM.Get(d) != v {
+				continue links
+			}
+		}
+		value := url.UTM.Get(dimension)
+		row, ok := byValue[value]
+		if !ok {
+			row = &UTMClicks{Value: value}
+			byValue[value] = row
+		}
+		analytics := s.analytics[code]
+		row.Links++
+		row.ClickCount += analytics.ClickCount
+		row.HumanClickCount += analytics.HumanClickCount
+		row.BotClickCount += analytics.BotClickCount
+	}
+	rows := make([]UTMClicks, 0, len(byValue))
+	for _, row := range byValue {
+		rows = append(rows, *row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].ClickCount != rows[j].ClickCount {
+			return rows[i].ClickCount > rows[j].ClickCount
+		}
+		return rows[i].Value < rows[j].Value
+	})
+	if len(rows) > n {
+		rows = rows[:n]
+	}
+	return rows, nil
+}
+
+func (s *MemoryLinkStore) TopClicked(ctx context.Context, n int) ([]LinkClicks, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	links := make([]LinkClicks, 0, len(s.analytics))
+	for code, analytics := range s.analytics {
+		url, ok := s.links[code]
+		if !ok {
+			continue
+		}
+		links = append(links, LinkClicks{
+			ShortCode:      code,
+			LongURL:        url.LongURL,
+			PasswordHash:   url.PasswordHash,
+			Interstitial:   url.Interstitial,
+			RedirectStatus: url.RedirectStatus,
+			QueryMode:      url.QueryMode,
+			UTM:            url.UTM,
+			CreatedAt:      url.CreatedAt,
+			ClickCount:     analytics.ClickCount,
+		})
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].ClickCount > links[j].ClickCount })
+	if len(links) > n {
+		links = links[:n]
+	}
+	return links, nil
+}
+
+func (s *MemoryLinkStore) Count(ctx context.Context) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return int64(len(s.links)), nil
+}
+
+func (s *MemoryLinkStore) ScanShortCodes(ctx context.Context, batchSize int, fn func(codes []string)) error {
+	s.mu.RLock()
+	codes := make([]string, 0, len(s.links))
+	for code := range s.links {
+		codes = append(codes, code)
+	}
+	s.mu.RUnlock()
+
+	for len(codes) > 0 {
+		n := min(batchSize, len(codes))
+		fn(codes[:n])
+		codes = codes[n:]
+	}
+	return nil
+}
+
+func (s *MemoryLinkStore) Ping(ctx context.Context) error {
+	return nil
+}
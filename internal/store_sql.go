@@ -0,0 +1,221 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/plugin/dbresolver"
+)
+
+// SQLLinkStore keeps links in the urls and url_analytics tables. When db
+// has read replicas registered through dbresolver, lookups go to the
+// replicas and writes to the primary.
+type SQLLinkStore struct {
+	db         *gorm.DB
+	replicated bool
+}
+
+func NewSQLLinkStore(db *gorm.DB) *SQLLinkStore {
+	_, replicated := db.Config.Plugins[(&dbresolver.DBResolver{}).Name()]
+	return &SQLLinkStore{db: db, replicated: replicated}
+}
+
+func (s *SQLLinkStore) FindByCode(ctx context.Context, shortCode string) (LinkClicks, error) {
+	link, err := s.findByCode(s.db.WithContext(ctx), shortCode)
+	if errors.Is(err, ErrLinkNotFound) && s.replicated {
+		// Replicas lag behind the primary, so a link created moments ago
+		// may not be there yet: only a miss on the primary is final.
+		link, err = s.findByCode(s.db.WithContext(ctx).Clauses(dbresolver.Write), shortCode)
+	}
+	return link, err
+}
+
+func (s *SQLLinkStore) findByCode(db *gorm.DB, shortCode string) (LinkClicks, error) {
+	var link LinkClicks
+	err := db.Model(&URL{}).
+		Select("urls.short_code, urls.long_url, urls.password_hash, urls.interstitial, urls.redirect_status, "+
+			"urls.query_mode, "+utmColumns+", urls.created_at, COALESCE(url_analytics.click_count, 0) AS click_count").
+		Joins("LEFT JOIN url_analytics ON url_analytics.short_code = urls.short_code").
+		Where("urls.short_code = ?", shortCode).
+		Take(&link).Error
+	return link, notFound(err)
+}
+
+// FindDuplicate reads from the primary: it dedups link creation, which
+// must see links created moments ago.
+func (s *SQLLinkStore) FindDuplicate(ctx context.Context, want URL) (URL, error) {
+	var url URL
+	err := s.db.WithContext(ctx).Clauses(dbresolver.Write).
+		Where("long_url = ? AND password_hash = ''", want.LongURL).
+		Where("interstitial = ? AND redirect_status = ? AND query_mode = ?", want.Interstitial, want.RedirectStatus, want.QueryMode).
+		Where("utm_source = ? AND utm_medium = ? AND utm_campaign = ? AND utm_term = ? AND utm_content = ?",
+			want.UTM.Source, want.UTM.Medium, want.UTM.Campaign, want.UTM.Term, want.UTM.Content).
+		Take(&url).Error
+	return url, notFound(err)
+}
+
+func (s *SQLLinkStore) Create(ctx context.Context, url *URL) error {
+	return s.db.WithContext(ctx).Create(url).Error
+}
+
+func (s *SQLLinkStore) UpdateLink(ctx context.Context, shortCode string, upd LinkUpdate) (LinkClicks, error) {
+	changes := make(map[string]interface{})
+	if upd.Interstitial != nil {
+		changes["interstitial"] = *upd.Interstitial
+	}
+	if upd.UTM != nil {
+		for dimension, column := range UTMDimensions {
+			changes[column] = upd.UTM.Get(dimension)
+		}
+	}
+	if len(changes) > 0 {
+		res := s.db.WithContext(ctx).Model(&URL{}).Where("short_code = ?", shortCode).Updates(changes)
+		if res.Error != nil {
+			return LinkClicks{}, res.Error
+		}
+		if res.RowsAffected == 0 {
+			return LinkClicks{}, ErrLinkNotFound
+		}
+	}
+	return s.findByCode(s.db.WithContext(ctx).Clauses(dbresolver.Write), shortCode)
+}
+
+func (s *SQLLinkStore) Analytics(ctx context.Context, shortCode, batch string) (URLAnalytics, bool, error) {
+	// No analytics row yet just means nobody clicked
+	analytics := URLAnalytics{ShortCode: shortCode}
+	if batch == "" {
+		err := s.db.WithContext(ctx).Where("short_code = ?", shortCode).Limit(1).Find(&analytics).Error
+		return analytics, false, err
+	}
+
+	// A single statement sees a single snapshot of both tables
+	var row struct {
+		ClickCount, HumanClickCount, BotClickCount int64
+		BatchApplied                               bool
+	}
+	err := s.db.WithContext(ctx).Raw("SELECT COALESCE(a.click_count, 0) AS click_count, "+
+		"COALESCE(a.human_click_count, 0) AS human_click_count, COALESCE(a.bot_click_count, 0) AS bot_click_count, "+
+		"EXISTS (SELECT 1 FROM click_batches WHERE batch_id = ?) AS batch_applied "+
+		"FROM (SELECT 1) AS one LEFT JOIN url_analytics a ON a.short_code = ?", batch, shortCode).
+		Scan(&row).Error
+	analytics.ClickCount, analytics.HumanClickCount, analytics.BotClickCount = row.ClickCount, row.HumanClickCount, row.BotClickCount
+	return analytics, row.BatchApplied, err
+}
+
+// AddClicks writes every short code with a single multi-row statement:
+// insert initial counts, or increment existing counts atomically. Callers
+// pass records ordered by short code, keeping row lock order stable across
+// concurrent writers.
+func (s *SQLLinkStore) AddClicks(ctx context.Context, recs []URLAnalytics) error {
+	return addClicks(s.db.WithContext(ctx), recs)
+}
+
+// ApplyClickBatch relies on the batch's primary key: a concurrent flush of
+// the same batch waits for this transaction and then inserts nothing.
+func (s *SQLLinkStore) ApplyClickBatch(ctx context.Context, batch string, recs []URLAnalytics) (bool, error) {
+	applied := false
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&ClickBatch{BatchID: batch, AppliedAt: time.Now()})
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		if len(recs) > 0 {
+			if err := addClicks(tx, recs); err != nil {
+				return err
+			}
+		}
+		err := tx.Where("applied_at < ?", time.Now().Add(-clickBatchRetention)).Delete(&ClickBatch{}).Error
+		applied = err == nil
+		return err
+	})
+	return applied, err
+}
+
+func addClicks(db *gorm.DB, recs []URLAnalytics) error {
+	return db.Clauses(
+		clause.OnConflict{
+			Columns: []clause.Column{{Name: "short_code"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"click_count":       gorm.Expr("url_analytics.click_count + EXCLUDED.click_count"),
+				"human_click_count": gorm.Expr("url_analytics.human_click_count + EXCLUDED.human_click_count"),
+				"bot_click_count":   gorm.Expr("url_analytics.bot_click_count + EXCLUDED.bot_click_count"),
+			}),
+		},
+	).Create(&recs).Error
+}
+
+func (s *SQLLinkStore) ClicksByUTM(ctx context.Context, dimension string, filter UTM, n int) ([]UTMClicks, error) {
+	column, ok := UTMDimensions[dimension]
+	if !ok {
+		return nil, ErrInvalidUTM
+	}
+	query := s.db.WithContext(ctx).Model(&URL{}).
+		Select("urls." + column + " AS value, COUNT(*) AS links, " +
+			"COALESCE(SUM(url_analytics.click_count), 0) AS click_count, " +
+			"COALESCE(SUM(url_analytics.human_click_count), 0) AS human_click_count, " +
+			"COALESCE(SUM(url_analytics.bot_click_count), 0) AS bot_click_count").
+		Joins("LEFT JOIN url_analytics ON url_analytics.short_code = urls.short_code")
+	for d, c := range UTMDimensions {
+		if v := filter.Get(d); v != "" {
+			query = query.Where("urls."+c+" = ?", v)
+		}
+	}
+	var rows []UTMClicks
+	err := query.Group("urls." + column).
+		Order("click_count DESC").Order("urls." + column).
+		Limit(n).
+		Scan(&rows).Error
+	return rows, err
+}
+
+func (s *SQLLinkStore) TopClicked(ctx context.Context, n int) ([]LinkClicks, error) {
+	var links []LinkClicks
+	err := s.db.WithContext(ctx).Model(&URLAnalytics{}).
+		Select("urls.short_code, urls.long_url, urls.password_hash, urls.interstitial, urls.redirect_status, " +
+			"urls.query_mode, " + utmColumns + ", urls.created_at, url_analytics.click_count").
+		Joins("JOIN urls ON urls.short_code = url_analytics.short_code").
+		Order("url_analytics.click_count DESC").
+		Limit(n).
+		Scan(&links).Error
+	return links, err
+}
+
+func (s *SQLLinkStore) Count(ctx context.Context) (int64, error) {
+	var count int64
+	err := s.db.WithContext(ctx).Model(&URL{}).Count(&count).Error
+	return count, err
+}
+
+func (s *SQLLinkStore) ScanShortCodes(ctx context.Context, batchSize int, fn func(codes []string)) error {
+	var rows []URL
+	return s.db.WithContext(ctx).Model(&URL{}).Select("id", "short_code").
+		FindInBatches(&rows, batchSize, func(tx *gorm.DB, batch int) error {
+			codes := make([]string, len(rows))
+			for i, row := range rows {
+				codes[i] = row.ShortCode
+			}
+			fn(codes)
+			return nil
+		}).Error
+}
+
+func (s *SQLLinkStore) Ping(ctx context.Context) error {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// utmColumns selects the UTM fields of urls into LinkClicks.UTM.
+const utmColumns = "urls.utm_source, urls.utm_medium, urls.utm_campaign, urls.utm_term, urls.utm_content"
+
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrLinkNotFound
+	}
+	return err
+}
@@ -0,0 +1,45 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+)
+
+// amqpCarrier adapts AMQP message headers to a TextMapCarrier, so W3C trace
+// context travels with click events.
+type amqpCarrier amqp091.Table
+
+func (ac amqpCarrier) Get(key string) string {
+	v, _ := ac[key].(string)
+	return v
+}
+
+func (ac amqpCarrier) Set(key, value string) { ac[key] = value }
+
+func (ac amqpCarrier) Keys() []string {
+	keys := make([]string, 0, len(ac))
+	for k := range ac {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// InjectAMQP writes the trace context of ctx into headers, allocating them
+// when nil, and returns them.
+func InjectAMQP(ctx context.Context, headers amqp091.Table) amqp091.Table {
+	if headers == nil {
+		headers = amqp091.Table{}
+	}
+	otel.GetTextMapPropagator().Inject(ctx, amqpCarrier(headers))
+	return headers
+}
+
+// ExtractAMQP returns ctx carrying the trace context found in headers.
+func ExtractAMQP(ctx context.Context, headers amqp091.Table) context.Context {
+	if headers == nil {
+		return ctx
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, amqpCarrier(headers))
+}
@@ -0,0 +1,79 @@
+package tracing
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// fiberCarrier adapts request and response headers to a TextMapCarrier.
+type fiberCarrier struct {
+	c *fiber.Ctx
+}
+
+func (fc fiberCarrier) Get(key string) string { return fc.c.Get(key) }
+
+func (fc fiberCarrier) Set(key, value string) { fc.c.Set(key, value) }
+
+func (fc fiberCarrier) Keys() []string {
+	keys := make([]string, 0, len(fc.c.GetReqHeaders()))
+	for k := range fc.c.GetReqHeaders() {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// FiberMiddleware starts a server span per request, continuing the trace of
+// an incoming traceparent header. Handlers get the span through
+// c.UserContext(). Register it after the logger middleware so the request ID
+// is available.
+func FiberMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx := otel.GetTextMapPropagator().Extract(c.UserContext(), fiberCarrier{c})
+
+		method := strings.Clone(c.Method())
+		attrs := []attribute.KeyValue{
+			semconv.HTTPRequestMethodKey.String(method),
+			semconv.URLPath(strings.Clone(c.Path())),
+			semconv.ClientAddress(strings.Clone(c.IP())),
+			semconv.UserAgentOriginal(strings.Clone(c.Get("User-Agent"))),
+		}
+		if reqID, ok := c.Locals("request_id").(string); ok && reqID != "" {
+			attrs = append(attrs, attribute.String("request_id", strings.Clone(reqID)))
+		}
+
+		own := c.Route()
+		ctx, span := Tracer().Start(ctx, method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(attrs...),
+		)
+		defer span.End()
+		c.SetUserContext(ctx)
+
+		err := c.Next()
+
+		if r := c.Route(); r != own {
+			span.SetName(method + " " + r.Path)
+			span.SetAttributes(semconv.HTTPRoute(r.Path))
+		}
+
+		status := c.Response().StatusCode()
+		if err != nil {
+			status = fiber.StatusInternalServerError
+			if e, ok := err.(*fiber.Error); ok {
+				status = e.Code
+			}
+			span.RecordError(err)
+		}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= fiber.StatusInternalServerError {
+			span.SetStatus(codes.Error, "")
+		}
+		return err
+	}
+}
@@ -0,0 +1,93 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const maxUTMLength = 200
+
+var ErrInvalidUTM = errors.New("invalid utm")
+
+// UTM holds the campaign parameters redirects add to a link's destination.
+// They are stored apart from the destination so they can be edited and
+// reported on; empty fields are left out.
+type UTM struct {
+	Source   string `gorm:"type:varchar(200);not null;default:''" json:"source,omitempty"`
+	Medium   string `gorm:"type:varchar(200);not null;default:''" json:"medium,omitempty"`
+	Campaign string `gorm:"type:varchar(200);not null;default:''" json:"campaign,omitempty"`
+	Term     string `gorm:"type:varchar(200);not null;default:''" json:"term,omitempty"`
+	Content  string `gorm:"type:varchar(200);not null;default:''" json:"content,omitempty"`
+}
+
+// UTMDimensions are the UTM fields stats can be grouped by, as named in the
+// API, mapped to their column.
+var UTMDimensions = map[string]string{
+	"source":   "utm_source",
+	"medium":   "utm_medium",
+	"campaign": "utm_campaign",
+	"term":     "utm_term",
+	"content":  "utm_content",
+}
+
+// Normalize trims every field and checks its length.
+func (u UTM) Normalize() (UTM, error) {
+	fields := []*string{&u.Source, &u.Medium, &u.Campaign, &u.Term, &u.Content}
+	for i, f := range fields {
+		*f = strings.TrimSpace(*f)
+		if len(*f) > maxUTMLength {
+			return UTM{}, fmt.Errorf("%w: %s longer than %d characters", ErrInvalidUTM, u.names()[i], maxUTMLength)
+		}
+	}
+	return u, nil
+}
+
+func (u UTM) IsZero() bool {
+	return u == UTM{}
+}
+
+// Get returns the value of dimension, one of the UTMDimensions keys.
+func (u UTM) Get(dimension string) string {
+	for i, name := range u.names() {
+		if name == dimension {
+			return u.values()[i]
+		}
+	}
+	return ""
+}
+
+// Apply sets the non-empty fields on destination, replacing any utm_*
+// parameter it already has for them.
+func (u UTM) Apply(destination string) string {
+	return MergeQuery(destination, u.RawQuery(), QueryOverride)
+}
+
+// RawQuery encodes the non-empty fields as utm_* query parameters.
+func (u UTM) RawQuery() string {
+	params := make([]string, 0, 5)
+	for i, name := range u.names() {
+		if v := u.values()[i]; v != "" {
+			params = append(params, "utm_"+name+"="+url.QueryEscape(v))
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+func (u UTM) names() []string {
+	return []string{"source", "medium", "campaign", "term", "content"}
+}
+
+func (u UTM) values() []string {
+	return []string{u.Source, u.Medium, u.Campaign, u.Term, u.Content}
+}
+
+// UTMClicks are the persisted clicks of every link sharing a UTM value.
+type UTMClicks struct {
+	Value           string `json:"value"`
+	Links           int64  `json:"links"`
+	ClickCount      int64  `json:"clicks"`
+	HumanClickCount int64  `json:"human_clicks"`
+	BotClickCount   int64  `json:"bot_clicks"`
+}
@@ -0,0 +1,86 @@
+package internal
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Unique visitors are approximated with one Redis HyperLogLog per short code,
+// traffic class and UTC day. A visitor is identified by a hash of IP +
+// User-Agent salted with a random value that only exists for the day it belongs
+// to, so raw identifiers are never stored and hashes can't be correlated across
+// days.
+
+const (
+	visitorSaltPrefix = "uv:salt:"
+	uniqueVisitorsKey = "uv:"
+	// Keep yesterday's salt around for events that cross midnight in flight.
+	visitorSaltTTL = 48 * time.Hour
+)
+
+// VisitorDay returns the UTC day bucket for t, e.g. "20261018".
+func VisitorDay(t time.Time) string {
+	return t.UTC().Format("20060102")
+}
+
+// UniqueVisitorsKey is the HyperLogLog key holding visitors of the given
+// traffic class for shortCode on day.
+func UniqueVisitorsKey(shortCode string, class TrafficClass, day string) string {
+	return uniqueVisitorsKey + string(class) + ":" + shortCode + ":" + day
+}
+
+// VisitorHasher hashes IP + User-Agent with the salt of the current day.
+// The salt is shared between replicas through the cache and kept in memory.
+type VisitorHasher struct {
+	cache Cache
+
+	mu   sync.Mutex
+	day  string
+	salt string
+}
+
+func NewVisitorHasher(cache Cache) *VisitorHasher {
+	return &VisitorHasher{cache: cache}
+}
+
+// Hash returns the visitor ID for the given request attributes at time t.
+func (h *VisitorHasher) Hash(ctx context.Context, t time.Time, ip, userAgent string) (string, error) {
+	salt, err := h.saltFor(ctx, VisitorDay(t))
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(salt + "|" + ip + "|" + userAgent))
+	return hex.EncodeToString(sum[:16]), nil
+}
+
+func (h *VisitorHasher) saltFor(ctx context.Context, day string) (string, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.day == day {
+		return h.salt, nil
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate visitor salt: %w", err)
+	}
+
+	// First replica to ask wins; everyone else reads the stored salt.
+	key := visitorSaltPrefix + day
+	if _, err := h.cache.SetNX(ctx, key, hex.EncodeToString(buf), visitorSaltTTL); err != nil {
+		return "", fmt.Errorf("failed to store visitor salt: %w", err)
+	}
+	salt, err := h.cache.Get(ctx, key)
+	if err != nil {
+		return "", fmt.Errorf("failed to read visitor salt: %w", err)
+	}
+
+	h.day, h.salt = day, salt
+	return salt, nil
+}